@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+const pgpMessageType = "PGP MESSAGE"
+
+// Keys are what a post is encrypted to or decrypted with: OpenPGP keys, or
+// age recipients and identities.
+type Keys struct {
+	PGP openpgp.EntityList
+	// AgeRecipients are age public keys, to encrypt to.
+	AgeRecipients []age.Recipient
+	// AgeIdentities are age secret keys, to decrypt with.
+	AgeIdentities []age.Identity
+}
+
+// Add adds the given keys to k.
+func (k *Keys) Add(more *Keys) {
+	k.PGP = append(k.PGP, more.PGP...)
+	k.AgeRecipients = append(k.AgeRecipients, more.AgeRecipients...)
+	k.AgeIdentities = append(k.AgeIdentities, more.AgeIdentities...)
+}
+
+// errWrongPassphrase ends a decryption attempt after the passphrase given
+// didn't work, instead of asking again.
+var errWrongPassphrase = errors.New("wrong passphrase")
+
+// IsEncrypted returns whether the given post content is an armored OpenPGP
+// message or age file, as published by EncryptPost.
+func IsEncrypted(content string) bool {
+	return isPGP(content) || isAge(content)
+}
+
+func isPGP(content string) bool {
+	return strings.HasPrefix(strings.TrimSpace(content), "-----BEGIN "+pgpMessageType+"-----")
+}
+
+func isAge(content string) bool {
+	return strings.HasPrefix(strings.TrimSpace(content), agearmor.Header)
+}
+
+// EncryptPost encrypts the given text so it can be published in place of the
+// post. Given age recipients, it's an armored age file, which can also be
+// decrypted with age. Otherwise, it's an armored OpenPGP message, encrypted to
+// the OpenPGP public keys given or, if there are none, with the passphrase,
+// which can also be decrypted with gpg.
+func EncryptPost(text []byte, to *Keys, passphrase []byte) ([]byte, error) {
+	if to == nil {
+		to = &Keys{}
+	}
+	if len(to.AgeRecipients) > 0 {
+		if len(to.PGP) > 0 {
+			return nil, &Error{Kind: KindValidation, Msg: "A post can't be encrypted to both OpenPGP and age recipients."}
+		}
+		return encryptAge(text, to.AgeRecipients)
+	}
+	recipients := to.PGP
+	if len(recipients) == 0 && len(passphrase) == 0 {
+		return nil, &Error{Kind: KindValidation, Msg: "A passphrase or recipient is needed to encrypt the post."}
+	}
+
+	var b bytes.Buffer
+	aw, err := armor.Encode(&b, pgpMessageType, nil)
+	if err != nil {
+		return nil, err
+	}
+	var w io.WriteCloser
+	if len(recipients) > 0 {
+		w, err = openpgp.Encrypt(aw, recipients, nil, nil, nil)
+	} else {
+		w, err = openpgp.SymmetricallyEncrypt(aw, passphrase, nil, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if _, err := w.Write(text); err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// encryptAge encrypts the given text to the given age recipients, as an
+// armored age file.
+func encryptAge(text []byte, recipients []age.Recipient) ([]byte, error) {
+	var b bytes.Buffer
+	aw := agearmor.NewWriter(&b)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if _, err := w.Write(text); err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Couldn't encrypt post: %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// DecryptPost decrypts post content published by EncryptPost. keys are the
+// reader's secret keys or age identities, if it was encrypted to them. The
+// passphrase function is called when one is needed, either to unlock an
+// OpenPGP secret key or because the post was encrypted with a passphrase.
+func DecryptPost(content []byte, keys *Keys, passphrase func() ([]byte, error)) ([]byte, error) {
+	if keys == nil {
+		keys = &Keys{}
+	}
+	if isAge(string(content)) {
+		return decryptAge(content, keys.AgeIdentities)
+	}
+	block, err := armor.Decode(bytes.NewReader(bytes.TrimSpace(content)))
+	if err != nil || block.Type != pgpMessageType {
+		return nil, &Error{Kind: KindValidation, Msg: "Post isn't encrypted."}
+	}
+
+	tried := false
+	prompt := func(locked []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried {
+			return nil, errWrongPassphrase
+		}
+		tried = true
+		pass, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if symmetric {
+			return pass, nil
+		}
+		for _, k := range locked {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				if k.PrivateKey.Decrypt(pass) != nil {
+					return nil, errWrongPassphrase
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, keys.PGP, prompt, nil)
+	if err == nil {
+		var text []byte
+		text, err = ioutil.ReadAll(md.UnverifiedBody)
+		if err == nil {
+			return text, nil
+		}
+	}
+	if !tried {
+		return nil, &Error{Kind: KindBadToken, Msg: "Post is encrypted to a key you didn't give. Give your secret key to decrypt it.", Err: err}
+	}
+	if errors.Is(err, errWrongPassphrase) || errors.Is(err, pgperrors.ErrKeyIncorrect) {
+		return nil, &Error{Kind: KindBadToken, Msg: "Couldn't decrypt post: wrong passphrase.", Err: err}
+	}
+	return nil, &Error{Kind: KindBadToken, Msg: fmt.Sprintf("Couldn't decrypt post: %v", err), Err: err}
+}
+
+// decryptAge decrypts an armored age file with the given identities.
+func decryptAge(content []byte, identities []age.Identity) ([]byte, error) {
+	missing := &Error{Kind: KindBadToken, Msg: "Post is encrypted to an age key you didn't give. Give your age identity to decrypt it."}
+	if len(identities) == 0 {
+		return nil, missing
+	}
+	r, err := age.Decrypt(agearmor.NewReader(bytes.NewReader(bytes.TrimSpace(content))), identities...)
+	if err == nil {
+		var text []byte
+		text, err = ioutil.ReadAll(r)
+		if err == nil {
+			return text, nil
+		}
+	}
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		missing.Err = err
+		return nil, missing
+	}
+	return nil, &Error{Kind: KindBadToken, Msg: fmt.Sprintf("Couldn't decrypt post: %v", err), Err: err}
+}
+
+// ReadRecipient returns the keys to encrypt to for the given recipient: either
+// an age public key, or a file of keys read with ReadKeyFile.
+func ReadRecipient(recipient string) (*Keys, error) {
+	if strings.HasPrefix(recipient, "age1") {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, &Error{Kind: KindValidation, Msg: fmt.Sprintf("Invalid age recipient %s: %v", recipient, err), Err: err}
+		}
+		return &Keys{AgeRecipients: []age.Recipient{r}}, nil
+	}
+	return ReadKeyFile(recipient)
+}
+
+// ReadKeyFile reads keys from the given file: OpenPGP keys, either armored, as
+// exported by gpg --armor, or binary; age public keys, one per line; or age
+// identities, as generated by age-keygen. Posts can be encrypted to the public
+// keys of any identities, too.
+func ReadKeyFile(path string) (*Keys, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &Error{Kind: KindNotFound, Msg: fmt.Sprintf("Key file %s doesn't exist.", path), Err: err}
+		}
+		return nil, err
+	}
+	keys := &Keys{}
+	switch ageKeyType(b) {
+	case "age1":
+		keys.AgeRecipients, err = age.ParseRecipients(bytes.NewReader(b))
+	case "AGE-SECRET-KEY-":
+		keys.AgeIdentities, err = age.ParseIdentities(bytes.NewReader(b))
+		for _, id := range keys.AgeIdentities {
+			if x, ok := id.(*age.X25519Identity); ok {
+				keys.AgeRecipients = append(keys.AgeRecipients, x.Recipient())
+			}
+		}
+	default:
+		if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN")) {
+			keys.PGP, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+		} else {
+			keys.PGP, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+		}
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindValidation, Msg: fmt.Sprintf("Couldn't read keys from %s: %v", path, err), Err: err}
+	}
+	return keys, nil
+}
+
+// ageKeyType returns the prefix of the first key in the given age key file,
+// skipping comments: "age1" for public keys, or "AGE-SECRET-KEY-" for
+// identities. It returns "" for anything else.
+func ageKeyType(b []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, prefix := range []string{"age1", "AGE-SECRET-KEY-"} {
+			if strings.HasPrefix(line, prefix) {
+				return prefix
+			}
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func TestEncryptPost(t *testing.T) {
+	text := []byte("# Incident notes\n\nThe secret is out.\n")
+	pass := func(p string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(p), nil }
+	}
+
+	t.Run("passphrase", func(t *testing.T) {
+		enc, err := EncryptPost(text, nil, []byte("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(string(enc)) {
+			t.Fatalf("Expected armored message, got %q", enc)
+		}
+		dec, err := DecryptPost(enc, nil, pass("hunter2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dec) != string(text) {
+			t.Errorf("Expected %q, got %q", text, dec)
+		}
+		if _, err := DecryptPost(enc, nil, pass("wrong")); KindOf(err) != KindBadToken {
+			t.Errorf("Expected bad passphrase error, got %v", err)
+		}
+	})
+
+	t.Run("recipient", func(t *testing.T) {
+		e, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keys made by gpg list the hashes they prefer; this one doesn't
+		for _, id := range e.Identities {
+			id.SelfSignature.PreferredHash = []uint8{8} // SHA-256
+		}
+		keys := &Keys{PGP: openpgp.EntityList{e}}
+		enc, err := EncryptPost(text, keys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DecryptPost(enc, keys, pass(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dec) != string(text) {
+			t.Errorf("Expected %q, got %q", text, dec)
+		}
+		if _, err := DecryptPost(enc, nil, pass("hunter2")); KindOf(err) != KindBadToken {
+			t.Errorf("Expected missing key error, got %v", err)
+		}
+	})
+
+	t.Run("age", func(t *testing.T) {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(t.TempDir(), "key.txt")
+		if err := ioutil.WriteFile(file, []byte("# created by age-keygen\n"+id.String()+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := ReadKeyFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := ReadRecipient(id.Recipient().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, err := EncryptPost(text, to, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(string(enc)) {
+			t.Fatalf("Expected armored age file, got %q", enc)
+		}
+		dec, err := DecryptPost(enc, keys, pass(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(dec) != string(text) {
+			t.Errorf("Expected %q, got %q", text, dec)
+		}
+		// The identity file can be encrypted to, as well
+		if enc, err = EncryptPost(text, keys, nil); err != nil {
+			t.Fatal(err)
+		}
+		other, _ := age.GenerateX25519Identity()
+		if _, err := DecryptPost(enc, &Keys{AgeIdentities: []age.Identity{other}}, pass("")); KindOf(err) != KindBadToken {
+			t.Errorf("Expected wrong key error, got %v", err)
+		}
+		if _, err := DecryptPost(enc, nil, pass("hunter2")); KindOf(err) != KindBadToken {
+			t.Errorf("Expected missing key error, got %v", err)
+		}
+
+		e, _ := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+		to.PGP = openpgp.EntityList{e}
+		if _, err := EncryptPost(text, to, nil); KindOf(err) != KindValidation {
+			t.Errorf("Expected error encrypting to both kinds of keys, got %v", err)
+		}
+	})
+
+	if _, err := DecryptPost(text, nil, pass("hunter2")); KindOf(err) != KindValidation {
+		t.Errorf("Expected error decrypting plain text, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// How long to wait for another run to finish changing a data file, and
+	// how old a lock must be to be considered abandoned.
+	dataLockWait  = 10 * time.Second
+	dataLockStale = time.Minute
+)
+
+// lockDataFile keeps other runs from changing the data file with the given
+// name until the returned function is called. It waits for any other run
+// that's changing it, unless that run seems to have died while holding the
+// lock. what describes the file in errors, e.g. "Search index".
+func (s *Session) lockDataFile(name, what string) (func(), error) {
+	path := filepath.Join(s.opts.DataDir, name+".lock")
+	deadline := time.Now().Add(dataLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > dataLockStale {
+			s.logf("Removing stale %s lock from %s", strings.ToLower(what), fi.ModTime())
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another run. If none is running, remove %s", what, path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeDataFile writes the data file with the given name to a temporary file,
+// then moves it into place, so it's never seen half-written.
+func (s *Session) writeDataFile(name string, write func(io.Writer) error) error {
+	f, err := ioutil.TempFile(s.opts.DataDir, name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(s.opts.DataDir, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
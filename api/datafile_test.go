@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+func TestDataFilesConcurrent(t *testing.T) {
+	s, err := NewSession(Options{Host: "https://example.com", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("post%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.rememberVersion(&writeas.Post{ID: id, Updated: time.Now()}, id+".txt")
+			if err := s.SetExpiry(id, expires); err != nil {
+				t.Error(err)
+			}
+			if err := s.addStatsSnapshot(statsSnapshot{Time: time.Now(), User: id}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	versions, err := s.loadVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 10 {
+		t.Errorf("Expected all 10 versions to be recorded, got %d", len(versions))
+	}
+	posts, err := s.ExpiringPosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 10 {
+		t.Errorf("Expected all 10 expiry times to be recorded, got %d", len(posts))
+	}
+	snapshots, err := s.loadStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 10 {
+		t.Errorf("Expected all 10 stats snapshots to be saved, got %d", len(snapshots))
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/writeas-cli/fileutils"
+)
+
+const draftsDir = "drafts"
+
+// Draft is a post being written, saved locally until it's published.
+type Draft struct {
+	ID       string
+	Path     string
+	Modified time.Time
+	FrontMatter
+	Body []byte
+}
+
+// Summary returns a short, single-line description of the draft.
+func (d *Draft) Summary() string {
+	return summarize(string(d.Body))
+}
+
+// PostParams returns the parameters for publishing the draft.
+func (d *Draft) PostParams() *writeas.PostParams {
+	return d.FrontMatter.PostParams(d.Body)
+}
+
+// DraftsPath returns the directory drafts are saved in.
+func (s *Session) DraftsPath() string {
+	return filepath.Join(s.opts.DataDir, draftsDir)
+}
+
+// NewDraft creates an empty draft with the given options, ready to be written
+// in an editor. The draft's file has the given extension, e.g. ".md".
+func (s *Session) NewDraft(fm FrontMatter, ext string) (*Draft, error) {
+	dir := s.DraftsPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Error creating drafts folder: %v", err)
+	}
+	now := time.Now()
+	d := &Draft{
+		ID:          strconv.FormatInt(now.UnixNano(), 36),
+		Modified:    now,
+		FrontMatter: fm,
+	}
+	d.Path = filepath.Join(dir, d.ID+ext)
+	if err := s.SaveDraft(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SaveDraft writes the given draft to disk.
+func (s *Session) SaveDraft(d *Draft) error {
+	err := ioutil.WriteFile(d.Path, d.FrontMatter.Marshal(d.Body), 0600)
+	if err != nil {
+		return fmt.Errorf("Error saving draft: %v", err)
+	}
+	return nil
+}
+
+// Draft reads the draft with the given ID. Its file is found by comparing
+// names, not with a glob, so an ID like "*" can't match other drafts.
+func (s *Session) Draft(id string) (*Draft, error) {
+	dir := s.DraftsPath()
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if strings.TrimSuffix(name, filepath.Ext(name)) == id {
+			return readDraft(filepath.Join(dir, name))
+		}
+	}
+	return nil, &Error{Kind: KindNotFound, Msg: fmt.Sprintf("No draft %s.", id)}
+}
+
+// Drafts returns all saved drafts, most recently changed first.
+func (s *Session) Drafts() ([]Draft, error) {
+	dir := s.DraftsPath()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !fileutils.Exists(dir) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		d, err := readDraft(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, *d)
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].Modified.After(drafts[j].Modified)
+	})
+	return drafts, nil
+}
+
+// DeleteDraft removes the draft with the given ID.
+func (s *Session) DeleteDraft(id string) error {
+	d, err := s.Draft(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(d.Path)
+}
+
+func readDraft(path string) (*Draft, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading draft: %v", err)
+	}
+	name := filepath.Base(path)
+	d := &Draft{
+		ID:       strings.TrimSuffix(name, filepath.Ext(name)),
+		Path:     path,
+		Modified: fi.ModTime(),
+	}
+	d.FrontMatter, d.Body = ParseFrontMatter(text)
+	return d, nil
+}
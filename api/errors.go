@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind classifies the errors a Session returns, so callers can react to
+// them without parsing messages.
+type ErrorKind int
+
+const (
+	// KindOther is any error that doesn't fit one of the other kinds.
+	KindOther ErrorKind = iota
+	// KindNotLoggedIn means the operation needs an authenticated user.
+	KindNotLoggedIn
+	// KindNotFound means the post, blog or user doesn't exist.
+	KindNotFound
+	// KindBadToken means an edit token, access token or password was
+	// rejected.
+	KindBadToken
+	// KindNetwork means the server couldn't be reached.
+	KindNetwork
+	// KindValidation means the request was rejected as invalid, e.g. an
+	// empty post.
+	KindValidation
+	// KindConflict means the post was changed on the server since it was
+	// fetched here.
+	KindConflict
+)
+
+// Error is an error with a known kind.
+type Error struct {
+	Kind ErrorKind
+	Msg  string
+	// Err is the underlying error, if any.
+	Err error
+	// Status is the HTTP status of the response that caused it, or 0 if
+	// there wasn't one.
+	Status int
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrNotLoggedIn is returned by operations that need an authenticated user
+// when the Session doesn't have an access token.
+var ErrNotLoggedIn = &Error{Kind: KindNotLoggedIn, Msg: "Not currently logged in."}
+
+// KindOf returns the kind of the given error, or KindOther if it isn't known.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	var ce *ConflictError
+	if errors.As(err, &ce) {
+		return KindConflict
+	}
+	if IsNetworkError(err) {
+		return KindNetwork
+	}
+	return KindOther
+}
+
+// IsNetworkError returns whether the given error came from failing to reach
+// the API at all, rather than the API rejecting the request. go-writeas
+// flattens transport errors into strings that begin with "Request: ", so we
+// check for that as well as any net.Error.
+func IsNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind == KindNetwork
+	}
+	// Failing to open a local file isn't a network error, even though its
+	// underlying errno looks like one
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	return strings.Contains(err.Error(), "Request: ")
+}
+
+// newError returns an Error for a failed API call, classified by the status
+// of the response that caused it, or 0 if there wasn't one.
+func newError(err error, status int, msg string) *Error {
+	kind := KindOther
+	switch status {
+	case 0:
+		if IsNetworkError(err) {
+			kind = KindNetwork
+		}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = KindBadToken
+	case http.StatusNotFound, http.StatusGone:
+		kind = KindNotFound
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		kind = KindValidation
+	}
+	return &Error{Kind: kind, Msg: msg, Err: err, Status: status}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const expiryFile = "expiry.json"
+
+// postExpiry is when a post published here should be deleted.
+type postExpiry struct {
+	Expires time.Time `json:"expires"`
+	// User is who published the post, or empty if it was published
+	// anonymously.
+	User string `json:"user,omitempty"`
+}
+
+// ExpiringPost is a post that will be deleted by DeleteExpired once it
+// expires.
+type ExpiringPost struct {
+	ID      string
+	Expires time.Time
+	User    string
+}
+
+// ExpiryResult is the outcome of trying to delete a single expired post.
+type ExpiryResult struct {
+	Post ExpiringPost
+	// Gone is true if the post was already deleted some other way.
+	Gone    bool
+	Skipped bool
+	Err     error
+}
+
+func (s *Session) expiryPath() string {
+	return filepath.Join(s.opts.DataDir, expiryFile)
+}
+
+func (s *Session) loadExpiry() (map[string]postExpiry, error) {
+	expiry := map[string]postExpiry{}
+	b, err := ioutil.ReadFile(s.expiryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return expiry, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &expiry); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", expiryFile, err)
+	}
+	return expiry, nil
+}
+
+// updateExpiry changes the recorded expiry times with the given function,
+// while holding a lock so other runs don't change them at the same time.
+// They're saved if update returns true.
+func (s *Session) updateExpiry(update func(map[string]postExpiry) bool) error {
+	unlock, err := s.lockDataFile(expiryFile, "Post expiry file")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	expiry, err := s.loadExpiry()
+	if err != nil {
+		return err
+	}
+	if !update(expiry) {
+		return nil
+	}
+	b, err := json.MarshalIndent(expiry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeDataFile(expiryFile, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// SetExpiry records that the given post, just published by the session's
+// user, should be deleted after the given time.
+func (s *Session) SetExpiry(friendlyID string, expires time.Time) error {
+	return s.updateExpiry(func(expiry map[string]postExpiry) bool {
+		expiry[friendlyID] = postExpiry{Expires: expires, User: s.opts.User}
+		return true
+	})
+}
+
+// forgetExpiry stops tracking the expiry of the given post, once it's been
+// deleted.
+func (s *Session) forgetExpiry(friendlyID string) {
+	if s.opts.DataDir == "" {
+		return
+	}
+	err := s.updateExpiry(func(expiry map[string]postExpiry) bool {
+		if _, ok := expiry[friendlyID]; !ok {
+			return false
+		}
+		delete(expiry, friendlyID)
+		return true
+	})
+	if err != nil {
+		s.logf("Couldn't forget expiry of %s: %v", friendlyID, err)
+	}
+}
+
+// ExpiringPosts returns every post with an expiry, soonest to expire first.
+func (s *Session) ExpiringPosts() ([]ExpiringPost, error) {
+	expiry, err := s.loadExpiry()
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]ExpiringPost, 0, len(expiry))
+	for id, e := range expiry {
+		posts = append(posts, ExpiringPost{ID: id, Expires: e.Expires, User: e.User})
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].Expires.Equal(posts[j].Expires) {
+			return posts[i].ID < posts[j].ID
+		}
+		return posts[i].Expires.Before(posts[j].Expires)
+	})
+	return posts, nil
+}
+
+// DeleteExpired deletes every post that expired before now, using its
+// locally stored edit token, or else the session's login. Posts published by
+// a different user are skipped, as are all posts when dryRun is true. Posts
+// that were already deleted are forgotten. Failing to delete a post doesn't
+// stop the others from being deleted; check each result's Err.
+func (s *Session) DeleteExpired(now time.Time, dryRun bool) ([]ExpiryResult, error) {
+	posts, err := s.ExpiringPosts()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ExpiryResult{}
+	for _, p := range posts {
+		if p.Expires.After(now) {
+			break
+		}
+		if dryRun || (p.User != "" && p.User != s.opts.User) {
+			results = append(results, ExpiryResult{Post: p, Skipped: true})
+			continue
+		}
+
+		err := s.Delete(p.ID, s.TokenFromID(p.ID))
+		if err != nil && KindOf(err) == KindNotFound {
+			s.RemoveLocalPost(p.ID)
+			s.forgetExpiry(p.ID)
+			results = append(results, ExpiryResult{Post: p, Gone: true})
+			continue
+		}
+		results = append(results, ExpiryResult{Post: p, Err: err})
+	}
+	return results, nil
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// PostFilter selects posts to act on in bulk. Posts are taken from IDs,
+// Anonymous and Blog, combined; if none of those are given, every post known
+// here is taken: the session user's posts, if logged in, and anonymous posts
+// stored locally. Before, Match and Tags then narrow those down.
+type PostFilter struct {
+	// IDs are specific posts to select.
+	IDs []string
+	// Anonymous selects every anonymous post stored locally that hasn't been
+	// claimed by a user. The user's own posts that aren't on a blog, which on
+	// WriteFreely are their drafts, are never taken for it.
+	Anonymous bool
+	// Blog selects the user's posts on the blog with this alias.
+	Blog string
+
+	// Before, unless zero, keeps only posts created before then.
+	Before time.Time
+	// Match, if given, keeps only posts whose title matches it. Posts without
+	// a title are matched on their first line.
+	Match *regexp.Regexp
+	// Tags keeps only posts with all of these hashtags, in lowercase.
+	Tags []string
+}
+
+// FilterPosts returns the posts selected by the given filter, in the order
+// they were found. Anonymous posts stored locally that no longer exist are
+// left out.
+func (s *Session) FilterPosts(f PostFilter) ([]writeas.Post, error) {
+	all := len(f.IDs) == 0 && !f.Anonymous && f.Blog == ""
+	if f.Blog != "" && !s.LoggedIn() {
+		return nil, ErrNotLoggedIn
+	}
+
+	found := []writeas.Post{}
+	seen := map[string]bool{}
+	add := func(p *writeas.Post) {
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			found = append(found, *p)
+		}
+	}
+
+	for _, id := range f.IDs {
+		p, err := s.GetPost(id)
+		if err != nil {
+			if KindOf(err) == KindNotFound {
+				return nil, &Error{Kind: KindNotFound, Msg: "Post " + id + " doesn't exist.", Err: err}
+			}
+			return nil, err
+		}
+		add(p)
+	}
+	if f.Anonymous || all {
+		for _, lp := range s.LocalPosts() {
+			p, err := s.GetPost(lp.ID)
+			if err != nil {
+				if KindOf(err) == KindNotFound {
+					s.logf("Skipping %s: %v", lp.ID, err)
+					continue
+				}
+				return nil, err
+			}
+			if !all && p.OwnerName != "" {
+				s.logf("Skipping %s: it's owned by %s", lp.ID, p.OwnerName)
+				continue
+			}
+			add(p)
+		}
+	}
+	if s.LoggedIn() && (f.Blog != "" || all) {
+		posts, err := s.UserPosts()
+		if err != nil {
+			return nil, err
+		}
+		for i := range posts {
+			p := &posts[i]
+			if all || (p.Collection != nil && p.Collection.Alias == f.Blog) {
+				add(p)
+			}
+		}
+	}
+
+	posts := found[:0]
+	for _, p := range found {
+		if !f.Before.IsZero() && !p.Created.Before(f.Before) {
+			continue
+		}
+		if f.Match != nil && !f.Match.MatchString(PostTitle(&p)) {
+			continue
+		}
+		if !hasTags(PostTags(p.Content), f.Tags) {
+			continue
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
+
+// PostTitle returns the given post's title or, if it doesn't have one, its
+// first line.
+func PostTitle(p *writeas.Post) string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(p.Content), "\n", 2)[0])
+}
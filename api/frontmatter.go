@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+)
+
+const frontMatterDelim = "---"
+
+// FrontMatter holds the publishing options stored at the top of a draft or
+// a file to publish, between lines of "---", e.g.:
+//
+//	---
+//	blog: notes
+//	font: serif
+//	lang: en
+//	tags: travel, photos
+//	---
+type FrontMatter struct {
+	Blog string
+	Font string
+	Lang string
+	// Tags are added to the end of the post as hashtags when it's published.
+	Tags []string
+}
+
+// ParseFrontMatter splits the given text into its front matter and the post
+// that follows it. Text without front matter is returned as-is, with empty
+// front matter. Unknown keys are ignored.
+func ParseFrontMatter(text []byte) (FrontMatter, []byte) {
+	fm := FrontMatter{}
+	line, pos := nextLine(text, 0)
+	if line != frontMatterDelim {
+		return fm, text
+	}
+
+	for pos < len(text) {
+		line, pos = nextLine(text, pos)
+		if line == frontMatterDelim {
+			return fm, bytes.TrimLeft(text[pos:], "\r\n")
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "blog", "collection":
+			fm.Blog = v
+		case "font":
+			fm.Font = v
+		case "lang", "language":
+			fm.Lang = v
+		case "tags":
+			fm.Tags = parseTags(v)
+		}
+	}
+	// No closing delimiter, so this wasn't front matter after all
+	return FrontMatter{}, text
+}
+
+// IsZero returns whether none of the options are set.
+func (fm FrontMatter) IsZero() bool {
+	return fm.Blog == "" && fm.Font == "" && fm.Lang == "" && len(fm.Tags) == 0
+}
+
+// parseTags parses a list of tags from front matter, separated by commas or
+// spaces, and optionally in brackets or with #s, e.g. "[travel, #photos]".
+func parseTags(v string) []string {
+	tags := []string{}
+	for _, t := range strings.FieldsFunc(strings.Trim(v, "[]"), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		if t = strings.Trim(t, `#"'`); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// nextLine returns the line of text starting at pos, without its line ending
+// or surrounding space, and the position of the line after it.
+func nextLine(text []byte, pos int) (string, int) {
+	end := bytes.IndexByte(text[pos:], '\n')
+	if end == -1 {
+		return strings.TrimSpace(string(text[pos:])), len(text)
+	}
+	return strings.TrimSpace(string(text[pos : pos+end])), pos + end + 1
+}
+
+// Marshal returns the front matter followed by the given post. Every key is
+// written, even if empty, so they can be filled in by hand, except for tags,
+// which are only written if there are some.
+func (fm FrontMatter) Marshal(body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(frontMatterDelim + "\n")
+	for _, kv := range [][2]string{{"blog", fm.Blog}, {"font", fm.Font}, {"lang", fm.Lang}} {
+		b.WriteString(strings.TrimSpace(kv[0]+": "+kv[1]) + "\n")
+	}
+	if len(fm.Tags) > 0 {
+		b.WriteString("tags: " + strings.Join(fm.Tags, ", ") + "\n")
+	}
+	b.WriteString(frontMatterDelim + "\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// PostParams returns the parameters for publishing the given post with these
+// options. Tags the post doesn't already have are added to it as hashtags.
+func (fm FrontMatter) PostParams(body []byte) *writeas.PostParams {
+	pp := &writeas.PostParams{
+		Font:       fm.Font,
+		Collection: fm.Blog,
+	}
+	pp.Title, pp.Content = posts.ExtractTitle(string(body))
+	pp.Content = appendTags(pp.Content, fm.Tags)
+	if fm.Lang != "" {
+		lang := fm.Lang
+		pp.Language = &lang
+	}
+	return pp
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/writeas/web-core/posts"
+)
+
+const (
+	indexFile = "index"
+	// indexVersion changes whenever the index format does, so old indexes
+	// are rebuilt instead of misread.
+	indexVersion = 2
+
+	// BM25 ranking parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchIndex is an inverted index of the post files in a posts directory.
+type searchIndex struct {
+	Version int
+	// Dir is the posts directory that's indexed.
+	Dir string
+	// Docs are the indexed files, by their path relative to Dir, with
+	// forward slashes.
+	Docs map[string]*indexDoc
+	// Terms maps each word to the files it's in, and its positions in each.
+	Terms map[string]map[string][]int
+}
+
+// indexDoc is a single indexed file.
+type indexDoc struct {
+	ID      string
+	Title   string
+	Blog    string
+	Tags    []string
+	ModTime time.Time
+	Size    int64
+	// Length is the number of words in the file, and Words the distinct
+	// ones, so the file can be removed from Terms without looking through
+	// every word.
+	Length int
+	Words  []string
+}
+
+func newSearchIndex(dir string) *searchIndex {
+	return &searchIndex{
+		Version: indexVersion,
+		Dir:     dir,
+		Docs:    map[string]*indexDoc{},
+		Terms:   map[string]map[string][]int{},
+	}
+}
+
+func (s *Session) indexPath() string {
+	return filepath.Join(s.opts.DataDir, indexFile)
+}
+
+// loadIndex reads the index of the given posts directory. An index that's
+// missing, unreadable, or of another directory is replaced by an empty one.
+func (s *Session) loadIndex(dir string) *searchIndex {
+	if s.opts.DataDir == "" {
+		return newSearchIndex(dir)
+	}
+	f, err := os.Open(s.indexPath())
+	if err != nil {
+		return newSearchIndex(dir)
+	}
+	defer f.Close()
+	idx := &searchIndex{}
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		s.logf("Rebuilding search index: %v", err)
+		return newSearchIndex(dir)
+	}
+	if idx.Version != indexVersion || idx.Dir != dir {
+		return newSearchIndex(dir)
+	}
+	return idx
+}
+
+// saveIndex writes the index, so that it's never seen half-written.
+func (s *Session) saveIndex(idx *searchIndex) error {
+	return s.writeDataFile(indexFile, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(idx)
+	})
+}
+
+// UpdateIndex brings the search index of the given posts directory up to
+// date, indexing files added or changed since it was last updated and
+// dropping removed ones, and returns it. Only the files that changed are
+// read, and the index is only read again if it has to be changed.
+func (s *Session) UpdateIndex(dir string) (*searchIndex, error) {
+	idx := s.loadIndex(dir)
+	changed, removed, err := idx.changes()
+	if err != nil || (len(changed) == 0 && len(removed) == 0) {
+		return idx, err
+	}
+	return s.updateIndex(dir, func(idx *searchIndex) error {
+		// Check again, now that no one else is updating it
+		changed, removed, err := idx.changes()
+		if err != nil {
+			return err
+		}
+		for _, rel := range removed {
+			idx.remove(rel)
+		}
+		return s.indexFiles(idx, changed)
+	})
+}
+
+// reindexFiles updates the given files, relative to the posts directory, in
+// its search index, as they're pulled or pushed.
+func (s *Session) reindexFiles(dir string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	_, err := s.updateIndex(dir, func(idx *searchIndex) error {
+		return s.indexFiles(idx, files)
+	})
+	if err != nil {
+		s.logf("Couldn't update search index: %v", err)
+	}
+}
+
+// updateIndex changes the index of the given posts directory with the given
+// function, while holding the lock, then saves and returns it. Without a data
+// directory, the index is only kept in memory.
+func (s *Session) updateIndex(dir string, update func(*searchIndex) error) (*searchIndex, error) {
+	if s.opts.DataDir == "" {
+		idx := newSearchIndex(dir)
+		return idx, update(idx)
+	}
+	unlock, err := s.lockDataFile(indexFile, "Search index")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	idx := s.loadIndex(dir)
+	if err := update(idx); err != nil {
+		return nil, err
+	}
+	return idx, s.saveIndex(idx)
+}
+
+// changes returns the files in the indexed directory that were added or
+// changed since they were indexed, and those that were removed.
+func (idx *searchIndex) changes() (changed, removed []string, err error) {
+	seen := map[string]bool{}
+	err = filepath.Walk(idx.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path == idx.Dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if fi.IsDir() || filepath.Ext(path) != PostFileExt {
+			return nil
+		}
+		rel, err := filepath.Rel(idx.Dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		if d, ok := idx.Docs[rel]; !ok || !d.ModTime.Equal(fi.ModTime()) || d.Size != fi.Size() {
+			changed = append(changed, rel)
+		}
+		return nil
+	})
+	for rel := range idx.Docs {
+		if !seen[rel] {
+			removed = append(removed, rel)
+		}
+	}
+	return changed, removed, err
+}
+
+// indexFiles reads and indexes the given files, relative to the indexed
+// directory, replacing any earlier versions of them. Files that no longer
+// exist are removed from the index.
+func (s *Session) indexFiles(idx *searchIndex, files []string) error {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	for id, v := range versions {
+		if v.File != "" {
+			ids[filepath.ToSlash(v.File)] = id
+		}
+	}
+
+	for _, rel := range files {
+		rel = filepath.ToSlash(rel)
+		idx.remove(rel)
+		path := filepath.Join(idx.Dir, filepath.FromSlash(rel))
+		fi, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		d := &indexDoc{
+			ID:      ids[rel],
+			ModTime: fi.ModTime(),
+			Size:    fi.Size(),
+		}
+		if d.ID == "" && !strings.Contains(rel, "/") {
+			// Posts that aren't on a blog are saved by their ID
+			d.ID = strings.TrimSuffix(rel, PostFileExt)
+		}
+		if i := strings.Index(rel, "/"); i >= 0 {
+			d.Blog = rel[:i]
+		}
+		title, content := posts.ExtractTitle(string(text))
+		d.Title = title
+		d.Tags = PostTags(content)
+		words := tokenize(string(text))
+		d.Length = len(words)
+		for i, w := range words {
+			if idx.Terms[w] == nil {
+				idx.Terms[w] = map[string][]int{}
+			}
+			if len(idx.Terms[w][rel]) == 0 {
+				d.Words = append(d.Words, w)
+			}
+			idx.Terms[w][rel] = append(idx.Terms[w][rel], i)
+		}
+		idx.Docs[rel] = d
+	}
+	return nil
+}
+
+// remove drops the given file from the index.
+func (idx *searchIndex) remove(rel string) {
+	d, ok := idx.Docs[rel]
+	if !ok {
+		return
+	}
+	delete(idx.Docs, rel)
+	for _, w := range d.Words {
+		delete(idx.Terms[w], rel)
+		if len(idx.Terms[w]) == 0 {
+			delete(idx.Terms, w)
+		}
+	}
+}
+
+// indexHit is a file that matched a query, with its relevance.
+type indexHit struct {
+	File  string
+	Doc   *indexDoc
+	Score float64
+}
+
+// query returns the indexed files matching the given query, most relevant
+// first, ranked by BM25. Files that only match tags are ranked by when they
+// were changed, newest first.
+func (idx *searchIndex) query(q TextQuery, blog string, since time.Time) []indexHit {
+	terms := q.terms()
+	total := 0
+	for _, d := range idx.Docs {
+		total += d.Length
+	}
+	avgLen := float64(total) / float64(len(idx.Docs))
+
+	hits := []indexHit{}
+	for rel, d := range idx.Docs {
+		if (blog != "" && d.Blog != blog) || (!since.IsZero() && d.ModTime.Before(since)) || !hasTags(d.Tags, q.Tags) {
+			continue
+		}
+		found := true
+		for _, t := range terms {
+			if len(idx.Terms[t][rel]) == 0 {
+				found = false
+				break
+			}
+		}
+		for i := 0; i < len(q.Phrases) && found; i++ {
+			found = hasPhrase(q.Phrases[i], func(t string) []int { return idx.Terms[t][rel] })
+		}
+		if found {
+			hits = append(hits, indexHit{File: rel, Doc: d, Score: idx.score(rel, terms, avgLen)})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if !hits[i].Doc.ModTime.Equal(hits[j].Doc.ModTime) {
+			return hits[i].Doc.ModTime.After(hits[j].Doc.ModTime)
+		}
+		return hits[i].File < hits[j].File
+	})
+	return hits
+}
+
+// score returns the BM25 relevance of the given file to the given terms,
+// given the average length of the indexed files.
+func (idx *searchIndex) score(rel string, terms []string, avgLen float64) float64 {
+	n := float64(len(idx.Docs))
+	length := float64(idx.Docs[rel].Length)
+
+	score := 0.0
+	for _, t := range terms {
+		df := float64(len(idx.Terms[t]))
+		tf := float64(len(idx.Terms[t][rel]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avgLen))
+	}
+	return score
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Query  string
+		Result TextQuery
+	}{
+		{
+			"Words",
+			"Budget  launch",
+			TextQuery{Words: []string{"budget", "launch"}},
+		}, {
+			"Phrase",
+			`"launch plan" budget`,
+			TextQuery{Words: []string{"budget"}, Phrases: [][]string{{"launch", "plan"}}},
+		}, {
+			"Single quoted word",
+			`"budget"`,
+			TextQuery{Words: []string{"budget"}},
+		}, {
+			"Tags",
+			"#Work tag:ideas notes",
+			TextQuery{Words: []string{"notes"}, Tags: []string{"work", "ideas"}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := ParseQuery(tc.Query)
+			if !reflect.DeepEqual(out, tc.Result) {
+				t.Errorf("Incorrect output, expecting %+v but got %+v", tc.Result, out)
+			}
+		})
+	}
+}
+
+func writeIndexed(t *testing.T, dir, name, content string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func indexedFiles(hits []indexHit) []string {
+	files := []string{}
+	for _, h := range hits {
+		files = append(files, h.File)
+	}
+	return files
+}
+
+func TestSearchIndex(t *testing.T) {
+	s, err := NewSession(Options{Host: "https://example.com", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	then := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeIndexed(t, dir, "post1.txt", "# Budget\n\nThe budget for the launch plan. #work", then)
+	writeIndexed(t, dir, "post2.txt", "Plan the launch, then the budget.", then)
+	writeIndexed(t, dir, "notes/ideas.txt", "Nothing about money. #work #ideas", then)
+	if _, err := s.UpdateIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []struct {
+		Query string
+		Blog  string
+		Files []string
+	}{
+		{"budget", "", []string{"post1.txt", "post2.txt"}},
+		{"launch budget", "", []string{"post1.txt", "post2.txt"}},
+		{`"launch plan"`, "", []string{"post1.txt"}},
+		{"#work", "", []string{"notes/ideas.txt", "post1.txt"}},
+		{"#work budget", "", []string{"post1.txt"}},
+		{"#work", "notes", []string{"notes/ideas.txt"}},
+		{"elephant", "", []string{}},
+	}
+	for _, q := range queries {
+		hits := s.loadIndex(dir).query(ParseQuery(q.Query), q.Blog, time.Time{})
+		if files := indexedFiles(hits); !reflect.DeepEqual(files, q.Files) {
+			t.Errorf("Query %q found %v, expected %v", q.Query, files, q.Files)
+		}
+	}
+
+	// Only changed and removed files are updated
+	writeIndexed(t, dir, "post2.txt", "Nothing to see here.", time.Now())
+	os.Remove(filepath.Join(dir, "post1.txt"))
+	idx := s.loadIndex(dir)
+	changed, removed, err := idx.changes()
+	if err != nil || !reflect.DeepEqual(changed, []string{"post2.txt"}) || !reflect.DeepEqual(removed, []string{"post1.txt"}) {
+		t.Fatalf("Unexpected changes: %v %v %v", changed, removed, err)
+	}
+	if idx, err = s.UpdateIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	if hits := idx.query(ParseQuery("budget"), "", time.Time{}); len(hits) != 0 {
+		t.Errorf("Expected no more budget posts, found %v", indexedFiles(hits))
+	}
+	if _, ok := s.loadIndex(dir).Terms["budget"]; ok {
+		t.Errorf("Removed words are still indexed")
+	}
+}
+
+func TestSearchIndexConcurrent(t *testing.T) {
+	s, err := NewSession(Options{Host: "https://example.com", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("post%d.txt", i)
+		writeIndexed(t, dir, name, fmt.Sprintf("Post number%d", i), time.Now())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.reindexFiles(dir, []string{name})
+		}()
+	}
+	wg.Wait()
+
+	if hits := s.loadIndex(dir).query(ParseQuery("post"), "", time.Time{}); len(hits) != 10 {
+		t.Errorf("Expected all 10 posts to be indexed, found %v", indexedFiles(hits))
+	}
+}
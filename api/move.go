@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// movedPost is the result of moving a single post, as returned by
+// WriteFreely's collect and disperse endpoints.
+type movedPost struct {
+	Code         int           `json:"code"`
+	ErrorMessage string        `json:"error_msg,omitempty"`
+	Post         *writeas.Post `json:"post,omitempty"`
+}
+
+// MovePost moves the authenticated user's post with the given ID to the blog
+// with the given alias or, if alias is empty, off of any blog, into the
+// user's drafts. go-writeas doesn't support moving posts, so the API is
+// called directly.
+func (s *Session) MovePost(friendlyID, alias string) (*writeas.Post, error) {
+	if !s.LoggedIn() {
+		return nil, ErrNotLoggedIn
+	}
+	var path string
+	var body interface{}
+	if alias == "" {
+		path = "/posts/disperse"
+		body = []string{friendlyID}
+	} else {
+		path = "/collections/" + url.PathEscape(alias) + "/collect"
+		body = []writeas.OwnedPostParams{{ID: friendlyID}}
+	}
+	results := []movedPost{}
+	if err := s.apiPost(path, body, &results); err != nil {
+		if e, ok := err.(*Error); ok && e.Kind != KindNetwork {
+			e.Msg = "Couldn't move post: " + e.Msg
+		}
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("Unexpected response moving post: %d results", len(results))
+	}
+	r := results[0]
+	if r.Code != http.StatusOK || r.Post == nil {
+		return nil, newError(fmt.Errorf("%s", r.ErrorMessage), r.Code, fmt.Sprintf("Couldn't move post: %s", r.ErrorMessage))
+	}
+	s.rememberVersion(r.Post, "")
+	return r.Post, nil
+}
+
+// apiPost sends the given data to the given API endpoint as the session's
+// user, and decodes the data in the response into result.
+func (s *Session) apiPost(path string, data, result interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.opts.Host+"/api"+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+s.opts.Token)
+	if s.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", s.opts.UserAgent)
+	}
+	resp, err := (&http.Client{Transport: s.transport}).Do(req)
+	if err != nil {
+		return newError(err, 0, err.Error())
+	}
+	defer resp.Body.Close()
+
+	env := struct {
+		Code         int             `json:"code"`
+		ErrorMessage string          `json:"error_msg"`
+		Data         json.RawMessage `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return newError(err, resp.StatusCode, fmt.Sprintf("Couldn't read response: %v", err))
+	}
+	if resp.StatusCode >= 300 {
+		return newError(fmt.Errorf("%s", env.ErrorMessage), resp.StatusCode, env.ErrorMessage)
+	}
+	return json.Unmarshal(env.Data, result)
+}
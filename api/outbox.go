@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+	"github.com/writeas/writeas-cli/fileutils"
+)
+
+const (
+	outboxDir = "outbox"
+
+	// Retry schedule for entries that fail to send from the outbox
+	outboxMinBackoff = 30 * time.Second
+	outboxMaxBackoff = 6 * time.Hour
+)
+
+// Actions that can be queued in the outbox.
+const (
+	OutboxPost   = "post"
+	OutboxUpdate = "update"
+	OutboxDelete = "delete"
+)
+
+// OutboxEntry is a post, update, or delete that couldn't be sent (or was
+// deliberately saved with --offline) and is waiting to be sent later.
+type OutboxEntry struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	User   string `json:"user,omitempty"`
+
+	// Target of an update or delete
+	PostID string `json:"post_id,omitempty"`
+	Token  string `json:"token,omitempty"`
+	// Base is when the post being updated was last changed in the version
+	// the update was made from. If it's been changed on the server since,
+	// the update isn't sent.
+	Base *time.Time `json:"base,omitempty"`
+
+	// Post content and options
+	Collection string   `json:"collection,omitempty"`
+	Font       string   `json:"font,omitempty"`
+	Lang       string   `json:"lang,omitempty"`
+	Markdown   bool     `json:"md,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Content    string   `json:"content,omitempty"`
+	// Expires is when a new post should be deleted, if it should be.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	NextTry   time.Time `json:"next_try"`
+	LastError string    `json:"last_error,omitempty"`
+	// Failed is set once the server has rejected the entry in a way that
+	// trying again won't fix, like a bad token or a deleted post. Failed
+	// entries are only retried when forced.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// OutboxResult is the outcome of trying to send a single outbox entry.
+type OutboxResult struct {
+	Entry OutboxEntry
+	// Post is the published or updated post, if the entry was sent.
+	Post    *writeas.Post
+	Skipped bool
+	Err     error
+}
+
+// Summary returns a short, single-line description of the entry.
+func (e *OutboxEntry) Summary() string {
+	switch e.Action {
+	case OutboxUpdate:
+		return "update " + e.PostID
+	case OutboxDelete:
+		return "delete " + e.PostID
+	}
+	return "post \"" + summarize(e.Content) + "\""
+}
+
+// summarize returns the title of the given post, or else its first line,
+// shortened to fit in a listing.
+func summarize(content string) string {
+	title, body := posts.ExtractTitle(content)
+	if title == "" {
+		title = body
+	}
+	title = strings.TrimSpace(strings.SplitN(title, "\n", 2)[0])
+	if len([]rune(title)) > 40 {
+		title, _ = trimToLength(title, 40)
+		title += "..."
+	}
+	return title
+}
+
+func (s *Session) outboxPath() string {
+	return filepath.Join(s.opts.DataDir, outboxDir)
+}
+
+// NewOutboxEntry returns a new outbox entry for the given action, to be sent
+// as the session's user. Fill in the details of the request, then save it with
+// Queue.
+func (s *Session) NewOutboxEntry(action string) *OutboxEntry {
+	now := time.Now()
+	return &OutboxEntry{
+		ID:      strconv.FormatInt(now.UnixNano(), 36),
+		Action:  action,
+		User:    s.opts.User,
+		Created: now,
+		NextTry: now,
+	}
+}
+
+// SetOutboxBase records the version of the post that the given update was
+// made from, as last seen from the server, so sending it later won't overwrite
+// changes made since. Updates to posts whose version isn't known are sent
+// unchecked.
+func (s *Session) SetOutboxBase(e *OutboxEntry) error {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return err
+	}
+	if known, ok := versions[e.PostID]; ok {
+		e.Base = &known.Updated
+	}
+	return nil
+}
+
+// Queue saves the given entry to the outbox, to be sent the next time the
+// outbox is flushed.
+func (s *Session) Queue(e *OutboxEntry) error {
+	dir := s.outboxPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Error creating outbox: %v", err)
+	}
+	entryJSON, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, e.ID+".json"), entryJSON, 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing to outbox: %v", err)
+	}
+	return nil
+}
+
+// Outbox returns all entries in the outbox for the session's host, oldest
+// first.
+func (s *Session) Outbox() ([]OutboxEntry, error) {
+	dir := s.outboxPath()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !fileutils.Exists(dir) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	entries := []OutboxEntry{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		entryJSON, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e := OutboxEntry{}
+		if err = json.Unmarshal(entryJSON, &e); err != nil {
+			return nil, fmt.Errorf("Bad outbox entry %s: %v", f.Name(), err)
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries, nil
+}
+
+// DropOutboxEntry removes the entry with the given ID from the outbox without
+// sending it.
+func (s *Session) DropOutboxEntry(id string) error {
+	fname := filepath.Join(s.outboxPath(), filepath.Base(id)+".json")
+	if !fileutils.Exists(fname) {
+		return fmt.Errorf("No outbox entry %s.", id)
+	}
+	return fileutils.DeleteFile(fname)
+}
+
+// FlushOutbox tries to send every entry in the outbox that belongs to the
+// session's user. Entries that previously failed are skipped until their
+// backoff period has passed, and entries marked as failed are skipped
+// entirely, unless force is true. Sent entries are removed. Entries that
+// couldn't reach the server, or that hit a server error, are kept and
+// scheduled for another try; the rest are kept and marked as failed, so they
+// can be dropped.
+func (s *Session) FlushOutbox(force bool) ([]OutboxResult, error) {
+	entries, err := s.Outbox()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []OutboxResult{}
+	now := time.Now()
+	for i := range entries {
+		e := entries[i]
+		if e.User != s.opts.User || (!force && (e.Failed || now.Before(e.NextTry))) {
+			results = append(results, OutboxResult{Entry: e, Skipped: true})
+			continue
+		}
+
+		p, err := s.sendOutboxEntry(&e)
+		if err == nil {
+			if err = s.DropOutboxEntry(e.ID); err != nil {
+				return results, err
+			}
+			results = append(results, OutboxResult{Entry: e, Post: p})
+			continue
+		}
+
+		e.Attempts++
+		e.LastError = err.Error()
+		e.NextTry = time.Now().Add(outboxBackoff(e.Attempts))
+		e.Failed = !retryable(err)
+		if serr := s.Queue(&e); serr != nil {
+			return results, serr
+		}
+		results = append(results, OutboxResult{Entry: e, Err: err})
+	}
+	return results, nil
+}
+
+// retryable returns whether sending an outbox entry again might succeed after
+// the given error: when the server couldn't be reached, had an error of its
+// own, or asked us to slow down. Anything else, like a rejected request or a
+// response we couldn't read, would only fail again.
+func retryable(err error) bool {
+	if KindOf(err) == KindNetwork {
+		return true
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status >= 500 || e.Status == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// outboxBackoff returns how long to wait before retrying an entry that has
+// failed the given number of times.
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxMinBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return d
+}
+
+func (s *Session) sendOutboxEntry(e *OutboxEntry) (*writeas.Post, error) {
+	switch e.Action {
+	case OutboxPost:
+		p, err := s.Publish(e.PostParams())
+		if err == nil && e.Expires != nil {
+			if err := s.SetExpiry(p.ID, *e.Expires); err != nil {
+				s.logf("Couldn't save expiry of %s: %v", p.ID, err)
+			}
+		}
+		return p, err
+	case OutboxUpdate:
+		if e.Base != nil {
+			if err := s.checkUpdated(e.PostID, *e.Base); err != nil {
+				return nil, err
+			}
+		}
+		return s.Update(e.PostID, e.Token, e.PostParams())
+	case OutboxDelete:
+		return nil, s.Delete(e.PostID, e.Token)
+	}
+	return nil, fmt.Errorf("Unknown outbox action %q", e.Action)
+}
+
+// PostParams returns the parameters for publishing or updating the entry's
+// post.
+func (e *OutboxEntry) PostParams() *writeas.PostParams {
+	fm := FrontMatter{Blog: e.Collection, Font: e.Font, Lang: e.Lang, Tags: e.Tags}
+	return fm.PostParams([]byte(e.Content))
+}
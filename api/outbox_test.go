@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	tt := []struct {
+		Name  string
+		Err   error
+		Retry bool
+	}{
+		{"Network", errors.New("Request: dial tcp: connection refused"), true},
+		{"Server", newError(errors.New("oops"), http.StatusInternalServerError, "oops"), true},
+		{"Unavailable", newError(errors.New("down"), http.StatusServiceUnavailable, "down"), true},
+		{"Too many", newError(errors.New("slow down"), http.StatusTooManyRequests, "slow down"), true},
+		{"Wrapped", fmt.Errorf("Couldn't send: %w", newError(errors.New("oops"), http.StatusBadGateway, "oops")), true},
+		{"Unclassified 4xx", newError(errors.New("teapot"), http.StatusTeapot, "teapot"), false},
+		{"Validation", newError(errors.New("empty"), http.StatusBadRequest, "empty"), false},
+		{"Decode", newError(errors.New("invalid character"), http.StatusOK, "invalid character"), false},
+		{"Local", errors.New("Unknown outbox action"), false},
+	}
+	for _, tc := range tt {
+		if got := retryable(tc.Err); got != tc.Retry {
+			t.Errorf("%s: expected retryable %t, got %t", tc.Name, tc.Retry, got)
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package api
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -11,11 +9,7 @@ import (
 	"time"
 
 	writeas "github.com/writeas/go-writeas/v2"
-	"github.com/writeas/writeas-cli/config"
-	"github.com/writeas/writeas-cli/executable"
 	"github.com/writeas/writeas-cli/fileutils"
-	"github.com/writeas/writeas-cli/log"
-	cli "gopkg.in/urfave/cli.v1"
 )
 
 const (
@@ -39,15 +33,20 @@ type RemotePost struct {
 	Collection,
 	EditToken string
 	Synced  bool
+	Created time.Time
 	Updated time.Time
+	Views   int64
 }
 
-func AddPost(c *cli.Context, id, token string) error {
-	hostDir, err := config.HostDirectory(c)
-	if err != nil {
-		return fmt.Errorf("Error checking for host directory: %v", err)
-	}
-	f, err := os.OpenFile(filepath.Join(config.UserDataDir(c.App.ExtraInfo()["configDir"]), hostDir, postsFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+// localPostsFile returns the path of the file listing anonymous posts and
+// their edit tokens.
+func (s *Session) localPostsFile() string {
+	return filepath.Join(s.opts.DataDir, postsFile)
+}
+
+// AddLocalPost stores the edit token for an anonymous post.
+func (s *Session) AddLocalPost(id, token string) error {
+	f, err := os.OpenFile(s.localPostsFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
 	if err != nil {
 		return fmt.Errorf("Error creating local posts list: %s", err)
 	}
@@ -62,35 +61,38 @@ func AddPost(c *cli.Context, id, token string) error {
 	return nil
 }
 
-// ClaimPost adds a local post to the authenticated user's account and deletes
-// the local reference
-func ClaimPosts(c *cli.Context, localPosts *[]Post) (*[]writeas.ClaimPostResult, error) {
-	cl, err := newClient(c)
-	if err != nil {
-		return nil, err
-	}
-
-	u, _ := config.LoadUser(c)
-	if u != nil {
-		cl.SetToken(u.AccessToken)
-	} else {
-		return nil, fmt.Errorf("Not currently logged in. Authenticate with: " + executable.Name() + " auth <username>")
+// Claim adds the given local posts to the authenticated user's account, and
+// deletes the local references to any that were claimed successfully.
+func (s *Session) Claim(localPosts []Post) ([]writeas.ClaimPostResult, error) {
+	if !s.LoggedIn() {
+		return nil, ErrNotLoggedIn
 	}
 
-	postsToClaim := make([]writeas.OwnedPostParams, len(*localPosts))
-	for i, post := range *localPosts {
+	postsToClaim := make([]writeas.OwnedPostParams, len(localPosts))
+	for i, post := range localPosts {
 		postsToClaim[i] = writeas.OwnedPostParams{
 			ID:    post.ID,
 			Token: post.EditToken,
 		}
 	}
 
-	return cl.ClaimPosts(&postsToClaim)
+	cl, rec := s.userClient()
+	results, err := cl.ClaimPosts(&postsToClaim)
+	if err != nil {
+		return nil, newError(err, rec.status, err.Error())
+	}
+	for _, r := range *results {
+		if r.ErrorMessage == "" && r.Post != nil {
+			s.RemoveLocalPost(r.Post.ID)
+		}
+	}
+	return *results, nil
 }
 
-func TokenFromID(c *cli.Context, id string) string {
-	hostDir, _ := config.HostDirectory(c)
-	post := fileutils.FindLine(filepath.Join(config.UserDataDir(c.App.ExtraInfo()["configDir"]), hostDir, postsFile), id)
+// TokenFromID returns the locally stored edit token for the given post, or an
+// empty string if there isn't one.
+func (s *Session) TokenFromID(id string) string {
+	post := fileutils.FindLine(s.localPostsFile(), id+separator)
 	if post == "" {
 		return ""
 	}
@@ -103,15 +105,14 @@ func TokenFromID(c *cli.Context, id string) string {
 	return parts[1]
 }
 
-func RemovePost(c *cli.Context, id string) {
-	hostDir, _ := config.HostDirectory(c)
-	fullPath := filepath.Join(config.UserDataDir(c.App.ExtraInfo()["configDir"]), hostDir, postsFile)
-	fileutils.RemoveLine(fullPath, id)
+// RemoveLocalPost removes the locally stored edit token for the given post.
+func (s *Session) RemoveLocalPost(id string) {
+	fileutils.RemoveLine(s.localPostsFile(), id+separator)
 }
 
-func GetPosts(c *cli.Context) *[]Post {
-	hostDir, _ := config.HostDirectory(c)
-	lines := fileutils.ReadData(filepath.Join(config.UserDataDir(c.App.ExtraInfo()["configDir"]), hostDir, postsFile))
+// LocalPosts returns all anonymous posts stored locally.
+func (s *Session) LocalPosts() []Post {
+	lines := fileutils.ReadData(s.localPostsFile())
 
 	posts := []Post{}
 
@@ -126,11 +127,13 @@ func GetPosts(c *cli.Context) *[]Post {
 		}
 	}
 
-	return &posts
+	return posts
 }
 
-func GetUserPosts(c *cli.Context, draftsOnly bool) ([]RemotePost, error) {
-	waposts, err := DoFetchPosts(c)
+// RemotePosts retrieves the authenticated user's posts, optionally only those
+// that aren't on a blog.
+func (s *Session) RemotePosts(draftsOnly bool) ([]RemotePost, error) {
+	waposts, err := s.UserPosts()
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +156,9 @@ func GetUserPosts(c *cli.Context, draftsOnly bool) ([]RemotePost, error) {
 			Excerpt: getExcerpt(p.Content),
 			Slug:    p.Slug,
 			Synced:  p.Slug != "",
+			Created: p.Created,
 			Updated: p.Updated,
+			Views:   p.Views,
 		}
 		if p.Collection != nil {
 			post.Collection = p.Collection.Alias
@@ -164,6 +169,12 @@ func GetUserPosts(c *cli.Context, draftsOnly bool) ([]RemotePost, error) {
 	return posts, nil
 }
 
+// Excerpt returns a preview of the given post content: its start, with its
+// lines joined, in at most two lines of 80 characters.
+func Excerpt(content string) string {
+	return searchSnippet(strings.Join(strings.Fields(content), " "), nil)
+}
+
 // getExcerpt takes in a content string and returns
 // a concatenated version. limited to no more than
 // two lines of 80 chars each. delimited by '...'
@@ -210,101 +221,11 @@ func trimToLength(in string, l int) (string, int) {
 	return string(c), spaceIdx
 }
 
-func ComposeNewPost() (string, *[]byte) {
-	f, err := fileutils.TempFile(os.TempDir(), "WApost", "txt")
-	if err != nil {
-		if config.Debug() {
-			panic(err)
-		} else {
-			log.Errorln("Error creating temp file: %s", err)
-			return "", nil
-		}
-	}
-	f.Close()
-
-	cmd := config.EditPostCmd(f.Name())
-	if cmd == nil {
-		os.Remove(f.Name())
-
-		fmt.Println(config.NoEditorErr)
-		return "", nil
-	}
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if err := cmd.Start(); err != nil {
-		os.Remove(f.Name())
-
-		if config.Debug() {
-			panic(err)
-		} else {
-			log.Errorln("Error starting editor: %s", err)
-			return "", nil
-		}
-	}
-
-	// If something fails past this point, the temporary post file won't be
-	// removed automatically. Calling function should handle this.
-	if err := cmd.Wait(); err != nil {
-		if config.Debug() {
-			panic(err)
-		} else {
-			log.Errorln("Editor finished with error: %s", err)
-			return "", nil
-		}
-	}
-
-	post, err := ioutil.ReadFile(f.Name())
-	if err != nil {
-		if config.Debug() {
-			panic(err)
-		} else {
-			log.Errorln("Error reading post: %s", err)
-			return "", nil
-		}
-	}
-	return f.Name(), &post
-}
-
+// WritePost saves the given post as a text file in postsDir.
 func WritePost(postsDir string, p *writeas.Post) error {
-	postFilename := p.ID
-	collDir := ""
-	if p.Collection != nil {
-		postFilename = p.Slug
-		collDir = p.Collection.Alias
-	}
-	postFilename += PostFileExt
-
 	txtFile := p.Content
 	if p.Title != "" {
 		txtFile = "# " + p.Title + "\n\n" + txtFile
 	}
-	return ioutil.WriteFile(filepath.Join(postsDir, collDir, postFilename), []byte(txtFile), 0644)
-}
-
-func ReadStdIn() []byte {
-	numBytes, numChunks := int64(0), int64(0)
-	r := bufio.NewReader(os.Stdin)
-	fullPost := []byte{}
-	buf := make([]byte, 0, 1024)
-	for {
-		n, err := r.Read(buf[:cap(buf)])
-		buf = buf[:n]
-		if n == 0 {
-			if err == nil {
-				continue
-			}
-			if err == io.EOF {
-				break
-			}
-			log.ErrorlnQuit("Error reading from stdin: %v", err)
-		}
-		numChunks++
-		numBytes += int64(len(buf))
-
-		fullPost = append(fullPost, buf...)
-		if err != nil && err != io.EOF {
-			log.ErrorlnQuit("Error appending to end of post: %v", err)
-		}
-	}
-
-	return fullPost
+	return ioutil.WriteFile(filepath.Join(postsDir, PostFilename(p)), []byte(txtFile), 0644)
 }
@@ -1,6 +1,10 @@
 package api
 
-import "testing"
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestTrimToLength(t *testing.T) {
 	tt := []struct {
@@ -101,3 +105,35 @@ func TestGetExcerpt(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 20) + "needle and then some more words after it"
+	tt := []struct {
+		Name   string
+		Text   string
+		Result string
+	}{
+		{
+			"No match in text",
+			"Only the title matched.",
+			"Only the title matched.",
+		}, {
+			"Match near the start",
+			"A needle in a haystack.",
+			"A needle in a haystack.",
+		}, {
+			"Match far from the start",
+			long,
+			"..." + strings.Repeat("word ", 11) + "needle and then some more\nwords after it",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := searchSnippet(tc.Text, regexp.MustCompile("needle").FindStringIndex(tc.Text))
+			if out != tc.Result {
+				t.Errorf("Incorrect output, expecting \"%s\" but got \"%s\"", tc.Result, out)
+			}
+		})
+	}
+}
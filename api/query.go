@@ -0,0 +1,129 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// TextQuery is a parsed search query. A post matches if it has all of the
+// words, each phrase as written, and all of the tags.
+type TextQuery struct {
+	Words   []string
+	Phrases [][]string
+	Tags    []string
+}
+
+// ParseQuery parses a search query. Words in double quotes are a phrase,
+// and words starting with # or tag: are tags. Case is ignored.
+func ParseQuery(s string) TextQuery {
+	q := TextQuery{}
+	for i, part := range strings.Split(s, `"`) {
+		if i%2 == 1 {
+			// Inside quotes
+			if phrase := tokenize(part); len(phrase) > 1 {
+				q.Phrases = append(q.Phrases, phrase)
+			} else {
+				q.Words = append(q.Words, phrase...)
+			}
+			continue
+		}
+		for _, f := range strings.Fields(part) {
+			if tag := strings.TrimPrefix(strings.TrimPrefix(f, "#"), "tag:"); tag != f {
+				if tag = strings.ToLower(tag); tag != "" {
+					q.Tags = append(q.Tags, tag)
+				}
+				continue
+			}
+			q.Words = append(q.Words, tokenize(f)...)
+		}
+	}
+	return q
+}
+
+// Empty returns whether the query has nothing to search for.
+func (q TextQuery) Empty() bool {
+	return len(q.Words) == 0 && len(q.Phrases) == 0 && len(q.Tags) == 0
+}
+
+// terms returns every word in the query, including those in phrases.
+func (q TextQuery) terms() []string {
+	terms := append([]string{}, q.Words...)
+	for _, p := range q.Phrases {
+		terms = append(terms, p...)
+	}
+	return terms
+}
+
+// Pattern returns a regular expression matching the query's words, phrases
+// and tags in text, for finding and highlighting them.
+func (q TextQuery) Pattern() *regexp.Regexp {
+	alts := []string{}
+	for _, w := range q.Words {
+		alts = append(alts, regexp.QuoteMeta(w))
+	}
+	for _, p := range q.Phrases {
+		words := make([]string, len(p))
+		for i, w := range p {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		alts = append(alts, strings.Join(words, `[^\pL\pN]+`))
+	}
+	for _, t := range q.Tags {
+		alts = append(alts, "#"+regexp.QuoteMeta(t))
+	}
+	if len(alts) == 0 {
+		// Matches nothing
+		return regexp.MustCompile(`[^\s\S]`)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(alts, "|"))
+}
+
+// Match returns whether a post with the given title and content matches the
+// query.
+func (q TextQuery) Match(title, content string) bool {
+	positions := map[string][]int{}
+	for i, t := range tokenize(title + "\n" + content) {
+		positions[t] = append(positions[t], i)
+	}
+	for _, t := range q.terms() {
+		if len(positions[t]) == 0 {
+			return false
+		}
+	}
+	for _, p := range q.Phrases {
+		if !hasPhrase(p, func(t string) []int { return positions[t] }) {
+			return false
+		}
+	}
+	return hasTags(PostTags(content), q.Tags)
+}
+
+// tokenize splits text into lowercase words, made of letters and numbers.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// hasPhrase returns whether the words of the given phrase appear one after
+// another, given where each word appears.
+func hasPhrase(phrase []string, positions func(string) []int) bool {
+	rest := make([]map[int]bool, len(phrase))
+	for i, w := range phrase[1:] {
+		rest[i+1] = map[int]bool{}
+		for _, p := range positions(w) {
+			rest[i+1][p] = true
+		}
+	}
+	for _, start := range positions(phrase[0]) {
+		found := true
+		for i := 1; i < len(phrase) && found; i++ {
+			found = rest[i][start+i]
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
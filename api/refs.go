@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// postURLExts are the extensions an instance accepts at the end of a post's
+// URL to get it in another format, e.g. https://write.as/abc.md.
+var postURLExts = []string{".md", ".txt"}
+
+// collectionsPath is where blogs are found under an instance's URL.
+const collectionsPath = "/api/collections/"
+
+// PostRef identifies a post, either by its ID or by its blog and slug.
+type PostRef struct {
+	// Host is the base URL of the instance the post is on, if it was given
+	// as part of a URL.
+	Host string
+	ID   string
+	Blog string
+	Slug string
+}
+
+func (r PostRef) String() string {
+	if r.Blog != "" {
+		return r.Blog + "/" + r.Slug
+	}
+	return r.ID
+}
+
+// ParsePostRef parses a post ID, a "blog/slug", or the post's URL, e.g.
+// https://example.com/blog/slug or https://write.as/abc.md. The scheme may be
+// left out of a URL. A URL with a single path segment, like
+// https://blog.example.com/slug, is parsed as an ID, and resolved as a post on
+// a blog with its own domain if there's no post with that ID.
+func ParsePostRef(s string) (PostRef, error) {
+	ref := PostRef{}
+	path := s
+	if i := strings.Index(s, "/"); strings.Contains(s, "://") || (i > 0 && strings.ContainsAny(s[:i], ".:")) {
+		// Blog aliases can't contain dots, so this is a host
+		if !strings.Contains(s, "://") {
+			s = "https://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return ref, fmt.Errorf("Couldn't read post URL %s.", s)
+		}
+		ref.Host = u.Scheme + "://" + u.Host
+		path = u.Path
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	last := parts[len(parts)-1]
+	if ref.Host != "" {
+		for _, ext := range postURLExts {
+			last = strings.TrimSuffix(last, ext)
+		}
+	}
+	switch {
+	case len(parts) == 1 && last != "":
+		ref.ID = last
+	case len(parts) == 2 && parts[0] != "" && last != "":
+		ref.Blog, ref.Slug = parts[0], last
+	default:
+		return ref, fmt.Errorf("Couldn't find a post in %s. Give a post ID, blog/slug, or the post's URL.", s)
+	}
+	return ref, nil
+}
+
+// GetPostRef retrieves the post the given reference points to. If it's on
+// another instance, it's retrieved anonymously from there, with the same
+// network options. If the URL it was parsed from turns out to be on a blog
+// with its own domain, the post is retrieved from the blog's instance.
+func (s *Session) GetPostRef(ref PostRef) (*writeas.Post, error) {
+	p, err := s.getPostRef(ref)
+	if err != nil && ref.Host != "" && ref.ID != "" && KindOf(err) != KindNetwork {
+		instance, alias, berr := s.domainBlog(ref.Host)
+		if berr != nil {
+			s.logf("%s isn't a blog's own domain: %v", ref.Host, berr)
+			return nil, err
+		}
+		s.logf("%s is blog %s on %s", ref.Host, alias, instance)
+		return s.getPostRef(PostRef{Host: instance, Blog: alias, Slug: ref.ID})
+	}
+	return p, err
+}
+
+func (s *Session) getPostRef(ref PostRef) (*writeas.Post, error) {
+	if ref.Host != "" && !sameHost(ref.Host, s.opts.Host) {
+		other, err := s.forHost(ref.Host)
+		if err != nil {
+			return nil, err
+		}
+		ref.Host = ""
+		return other.getPostRef(ref)
+	}
+	if ref.Blog != "" {
+		return s.GetCollectionPost(ref.Blog, ref.Slug)
+	}
+	return s.GetPost(ref.ID)
+}
+
+// domainBlog returns the instance and alias of the blog served at the given
+// host, like a blog on its own domain. WriteFreely serves the blog's
+// ActivityPub actor on its home page, whose ID is the blog's API URL.
+func (s *Session) domainBlog(host string) (instance, alias string, err error) {
+	req, err := http.NewRequest("GET", host+"/", nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	if s.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", s.opts.UserAgent)
+	}
+	resp, err := (&http.Client{Transport: s.transport}).Do(req)
+	if err != nil {
+		return "", "", newError(err, 0, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("home page returned %s", resp.Status)
+	}
+
+	actor := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&actor); err != nil {
+		return "", "", fmt.Errorf("couldn't read blog: %v", err)
+	}
+	u, err := url.Parse(actor.ID)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid blog ID %q", actor.ID)
+	}
+	i := strings.Index(u.Path, collectionsPath)
+	if i >= 0 {
+		alias = strings.Trim(u.Path[i+len(collectionsPath):], "/")
+	}
+	if alias == "" || strings.Contains(alias, "/") {
+		return "", "", fmt.Errorf("invalid blog ID %q", actor.ID)
+	}
+	return u.Scheme + "://" + u.Host + u.Path[:i], alias, nil
+}
+
+// forHost returns an anonymous session for another instance, without any
+// local data, that otherwise connects the same way as this one.
+func (s *Session) forHost(host string) (*Session, error) {
+	s.logf("Post is on %s", host)
+	opts := s.opts
+	opts.Host = host
+	opts.User, opts.Token, opts.DataDir = "", "", ""
+	return NewSession(opts)
+}
+
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
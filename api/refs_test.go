@@ -0,0 +1,40 @@
+package api
+
+import "testing"
+
+func TestParsePostRef(t *testing.T) {
+	tt := []struct {
+		Ref    string
+		Result PostRef
+		Err    bool
+	}{
+		{"aaaazzzzzzzza", PostRef{ID: "aaaazzzzzzzza"}, false},
+		{"notes/my-post", PostRef{Blog: "notes", Slug: "my-post"}, false},
+		{"https://write.as/abc.md", PostRef{Host: "https://write.as", ID: "abc"}, false},
+		{"https://example.com/notes/my-post", PostRef{Host: "https://example.com", Blog: "notes", Slug: "my-post"}, false},
+		{"http://localhost:8080/notes/my-post.txt?x=1#top", PostRef{Host: "http://localhost:8080", Blog: "notes", Slug: "my-post"}, false},
+		{"example.com/notes/my-post/", PostRef{Host: "https://example.com", Blog: "notes", Slug: "my-post"}, false},
+		{"notes/my.post", PostRef{Blog: "notes", Slug: "my.post"}, false},
+		{"https://example.com/", PostRef{}, true},
+		{"https://example.com/a/b/c", PostRef{}, true},
+		{"a/b/c", PostRef{}, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Ref, func(t *testing.T) {
+			ref, err := ParsePostRef(tc.Ref)
+			if tc.Err {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ref != tc.Result {
+				t.Errorf("Expected %+v but got %+v", tc.Result, ref)
+			}
+		})
+	}
+}
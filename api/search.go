@@ -0,0 +1,273 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+)
+
+// Where search results were found.
+const (
+	SourceRemote = "remote"
+	SourcePulled = "pulled"
+	SourceDraft  = "draft"
+)
+
+// SearchQuery is what to search for, and where.
+type SearchQuery struct {
+	// Text is the words, phrases and tags to search for. If it's nil,
+	// Pattern is matched against each post's title and body instead.
+	Text    *TextQuery
+	Pattern *regexp.Regexp
+	// Blog, if given, keeps only posts on the blog with this alias.
+	Blog string
+	// Since, unless zero, keeps only posts changed since then.
+	Since time.Time
+
+	// PostsDir is the directory posts were pulled to, if any.
+	PostsDir string
+	// Offline skips searching the user's posts on the server.
+	Offline bool
+}
+
+// SearchResult is a post that matched a search.
+type SearchResult struct {
+	Source string
+	// ID is the post's ID, or the draft's for drafts. It's empty for pulled
+	// files whose post isn't known.
+	ID string
+	// URL is where the post is published, if it is.
+	URL string
+	// Path is the post's local file, for pulled posts and drafts.
+	Path  string
+	Title string
+	Blog  string
+	// Snippet is the text around the first match, in the style of an
+	// excerpt.
+	Snippet string
+	Updated time.Time
+}
+
+// Search looks for posts matching the given query in the user's posts on
+// the server, if logged in, then in the posts directory and in local drafts.
+// A post found on the server isn't listed again for its pulled file. Text
+// queries search the posts directory through its index, which is updated
+// first, and list the pulled posts found most relevant first.
+func (s *Session) Search(q SearchQuery) ([]SearchResult, error) {
+	results := []SearchResult{}
+	found := map[string]bool{}
+
+	if s.LoggedIn() && !q.Offline {
+		userPosts, err := s.UserPosts()
+		if err != nil {
+			return nil, err
+		}
+		for i := range userPosts {
+			p := &userPosts[i]
+			if r, ok := matchPost(q, p, p.Updated); ok {
+				r.Source = SourceRemote
+				r.URL = s.PostURL(p)
+				results = append(results, r)
+				found[p.ID] = true
+			}
+		}
+	}
+
+	if q.PostsDir != "" {
+		var pulled []SearchResult
+		var err error
+		if q.Text != nil && s.opts.DataDir != "" {
+			pulled, err = s.searchIndex(q, found)
+		} else {
+			pulled, err = s.searchPulled(q, found)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, pulled...)
+	}
+
+	drafts, err := s.Drafts()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range drafts {
+		p := &writeas.Post{ID: d.ID, Content: string(d.Body)}
+		p.Title, p.Content = posts.ExtractTitle(p.Content)
+		if d.Blog != "" {
+			p.Collection = &writeas.Collection{Alias: d.Blog}
+		}
+		if r, ok := matchPost(q, p, d.Modified); ok {
+			r.Source = SourceDraft
+			r.Path = d.Path
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// searchPulled searches the post files in the posts directory, skipping
+// those of posts already found.
+func (s *Session) searchPulled(q SearchQuery, found map[string]bool) ([]SearchResult, error) {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]string{}
+	for id, v := range versions {
+		if v.File != "" {
+			ids[filepath.ToSlash(v.File)] = id
+		}
+	}
+
+	results := []SearchResult{}
+	err = filepath.Walk(q.PostsDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path == q.PostsDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if fi.IsDir() || filepath.Ext(path) != PostFileExt {
+			return nil
+		}
+		rel, err := filepath.Rel(q.PostsDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		id := ids[rel]
+		if id == "" && !strings.Contains(rel, "/") {
+			// Posts that aren't on a blog are saved by their ID
+			id = strings.TrimSuffix(rel, PostFileExt)
+		}
+		if id != "" && found[id] {
+			return nil
+		}
+
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p := &writeas.Post{ID: id}
+		p.Title, p.Content = posts.ExtractTitle(string(text))
+		if i := strings.Index(rel, "/"); i >= 0 {
+			p.Collection = &writeas.Collection{Alias: rel[:i]}
+		}
+		if r, ok := matchPost(q, p, fi.ModTime()); ok {
+			r.Source = SourcePulled
+			r.Path = path
+			if id != "" {
+				r.URL = s.opts.Host + "/" + id
+			}
+			results = append(results, r)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// searchIndex searches the index of the posts directory, skipping posts
+// already found.
+func (s *Session) searchIndex(q SearchQuery, found map[string]bool) ([]SearchResult, error) {
+	idx, err := s.UpdateIndex(q.PostsDir)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't update search index: %v", err)
+	}
+
+	results := []SearchResult{}
+	pattern := q.Text.Pattern()
+	for _, h := range idx.query(*q.Text, q.Blog, q.Since) {
+		if h.Doc.ID != "" && found[h.Doc.ID] {
+			continue
+		}
+		path := filepath.Join(q.PostsDir, filepath.FromSlash(h.File))
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			// Removed since it was indexed
+			continue
+		}
+		p := &writeas.Post{ID: h.Doc.ID}
+		p.Title, p.Content = posts.ExtractTitle(string(text))
+		content := strings.Join(strings.Fields(p.Content), " ")
+		r := SearchResult{
+			Source:  SourcePulled,
+			ID:      h.Doc.ID,
+			Path:    path,
+			Title:   PostTitle(p),
+			Blog:    h.Doc.Blog,
+			Snippet: searchSnippet(content, pattern.FindStringIndex(content)),
+			Updated: h.Doc.ModTime,
+		}
+		if r.ID != "" {
+			r.URL = s.opts.Host + "/" + r.ID
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// matchPost returns the search result for the given post, last changed at
+// the given time, if it matches the query.
+func matchPost(q SearchQuery, p *writeas.Post, updated time.Time) (SearchResult, bool) {
+	blog := ""
+	if p.Collection != nil {
+		blog = p.Collection.Alias
+	}
+	if q.Blog != "" && blog != q.Blog {
+		return SearchResult{}, false
+	}
+	if updated.IsZero() {
+		updated = p.Created
+	}
+	if !q.Since.IsZero() && updated.Before(q.Since) {
+		return SearchResult{}, false
+	}
+
+	text := strings.Join(strings.Fields(p.Content), " ")
+	var match []int
+	if q.Text != nil {
+		if !q.Text.Match(p.Title, p.Content) {
+			return SearchResult{}, false
+		}
+		match = q.Text.Pattern().FindStringIndex(text)
+	} else {
+		match = q.Pattern.FindStringIndex(text)
+		if match == nil && !q.Pattern.MatchString(p.Title) {
+			return SearchResult{}, false
+		}
+	}
+	return SearchResult{
+		ID:      p.ID,
+		Title:   PostTitle(p),
+		Blog:    blog,
+		Snippet: searchSnippet(text, match),
+		Updated: updated,
+	}, true
+}
+
+// searchSnippet returns an excerpt of the given text, starting a little
+// before the given match, if there is one.
+func searchSnippet(text string, match []int) string {
+	start := 0
+	if match != nil && match[0] > 60 {
+		start = match[0]
+		// Start on a word, up to 60 bytes before the match
+		if i := strings.IndexByte(text[match[0]-60:match[0]], ' '); i >= 0 {
+			start = match[0] - 60 + i + 1
+		}
+	}
+	// getExcerpt breaks lines before a space, leaving it on the next one
+	excerpt := strings.Replace(getExcerpt(text[start:]), "\n ", "\n", 1)
+	if start > 0 {
+		excerpt = "..." + excerpt
+	}
+	return excerpt
+}
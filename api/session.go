@@ -0,0 +1,175 @@
+// Package api publishes to and manages posts on Write.as and other
+// WriteFreely instances. It's the library behind the writeas and wf
+// command-line tools, and can be used on its own by creating a Session.
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// Options configure a Session.
+type Options struct {
+	// Host is the base URL of the WriteFreely instance, e.g.
+	// https://write.as. When going through Tor, this is the instance's onion
+	// address.
+	Host string
+	// User is the username of the account taking action, if any. It's
+	// recorded with queued outbox entries, and keeps Tor circuits for
+	// different accounts apart.
+	User string
+	// Token is the user's access token. Without one, requests are made
+	// anonymously.
+	Token string
+	// DataDir is the directory where edit tokens for anonymous posts and the
+	// outbox are stored for this host.
+	DataDir string
+	// UserAgent is sent with every request.
+	UserAgent string
+
+	// Timeout applies to each attempt at a request. Retries is the number of
+	// times a failed request is retried, starting RetryWait after the first
+	// attempt.
+	Timeout   time.Duration
+	Retries   int
+	RetryWait time.Duration
+
+	// Proxy is the URL of an http, https, or socks5 proxy to route requests
+	// through.
+	Proxy string
+	// TorSOCKS is the host:port of a Tor SOCKS proxy. If set, all requests go
+	// through Tor and Proxy is ignored.
+	TorSOCKS string
+	// TorIsolation sends each account's requests over separate Tor circuits.
+	TorIsolation bool
+
+	// CACert is a PEM file of extra certificate authorities to trust.
+	// ClientCert and ClientKey are a PEM certificate and key to present to the
+	// server; the key may be in the certificate file.
+	CACert     string
+	ClientCert string
+	ClientKey  string
+
+	// Logf, if set, receives diagnostic messages.
+	Logf func(string, ...interface{})
+	// Trace, if set, is called after every attempt at an HTTP request, for
+	// debugging. Tokens are redacted from what it's given.
+	Trace func(RequestTrace)
+}
+
+// Session talks to a single WriteFreely instance as a single user (or
+// anonymously), and keeps track of the local data that goes with it.
+type Session struct {
+	opts      Options
+	transport http.RoundTripper
+}
+
+// NewSession creates a Session with the given options.
+func NewSession(opts Options) (*Session, error) {
+	opts.Host = strings.TrimSuffix(opts.Host, "/")
+	if opts.Host == "" {
+		return nil, fmt.Errorf("No host given.")
+	}
+
+	httpOpts := httpOptions{
+		Timeout:    opts.Timeout,
+		Retries:    opts.Retries,
+		RetryWait:  opts.RetryWait,
+		Proxy:      opts.Proxy,
+		CACert:     opts.CACert,
+		ClientCert: opts.ClientCert,
+		ClientKey:  opts.ClientKey,
+		Logf:       opts.Logf,
+		Trace:      opts.Trace,
+	}
+	if opts.TorSOCKS != "" {
+		httpOpts.TorSOCKS = opts.TorSOCKS
+		httpOpts.Proxy = ""
+		if opts.TorIsolation {
+			httpOpts.TorAuth = torIsolationAuth(opts.Host, opts.User)
+		}
+	}
+	httpClient, err := newHTTPClient(httpOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		opts:      opts,
+		transport: httpClient.Transport,
+	}, nil
+}
+
+// Host returns the base URL of the instance.
+func (s *Session) Host() string {
+	return s.opts.Host
+}
+
+// User returns the username the session acts as.
+func (s *Session) User() string {
+	return s.opts.User
+}
+
+// LoggedIn returns whether the session has an access token.
+func (s *Session) LoggedIn() bool {
+	return s.opts.Token != ""
+}
+
+// client returns an API client for a single call, authenticated with the
+// given access token, if any. The status of the call's response is recorded
+// in the returned statusRecorder, so errors can be classified.
+func (s *Session) client(accessToken string) (*writeas.Client, *statusRecorder) {
+	rec := &statusRecorder{base: s.transport}
+	cl := writeas.NewClientWith(writeas.Config{
+		URL:   s.opts.Host + "/api",
+		Token: accessToken,
+	})
+	cl.SetClient(&http.Client{Transport: rec})
+	cl.UserAgent = s.opts.UserAgent
+	return cl, rec
+}
+
+// userClient returns an API client for a single call as the session's user,
+// or anonymously if it isn't logged in.
+func (s *Session) userClient() (*writeas.Client, *statusRecorder) {
+	return s.client(s.opts.Token)
+}
+
+// editClient returns an API client for changing a post, authorized by its edit
+// token, if any, or else by the logged in user.
+func (s *Session) editClient(token string) (*writeas.Client, *statusRecorder, error) {
+	if token != "" {
+		cl, rec := s.client("")
+		return cl, rec, nil
+	}
+	if !s.LoggedIn() {
+		return nil, nil, ErrNotLoggedIn
+	}
+	cl, rec := s.userClient()
+	return cl, rec, nil
+}
+
+func (s *Session) logf(format string, p ...interface{}) {
+	if s.opts.Logf != nil {
+		s.opts.Logf(format, p...)
+	}
+}
+
+// statusRecorder is an http.RoundTripper that records the status code of the
+// last response it receives.
+type statusRecorder struct {
+	base   http.RoundTripper
+	status int
+}
+
+func (t *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.status = resp.StatusCode
+	}
+	return resp, err
+}
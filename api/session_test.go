@@ -0,0 +1,96 @@
+package api
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/writeas-cli/internal/wftest"
+)
+
+func TestSession(t *testing.T) {
+	srv := wftest.NewServer(t)
+	srv.AddUser("matt", "secret")
+	srv.AddCollection("matt", "blog", "Matt's Blog")
+	dir := t.TempDir()
+
+	s, err := NewSession(Options{
+		Host:    srv.URL,
+		DataDir: dir,
+		CACert:  srv.WriteCACert(t, dir),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Anonymous posts keep their edit token locally
+	p, err := s.Publish(&writeas.PostParams{Title: "Hello", Content: "World"})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if url := s.PostURL(p); url != srv.URL+"/"+p.ID {
+		t.Errorf("Unexpected post URL %s", url)
+	}
+	token := s.TokenFromID(p.ID)
+	if token == "" {
+		t.Fatalf("Edit token wasn't stored")
+	}
+	if _, err = s.Update(p.ID, token, &writeas.PostParams{Content: "Updated"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err = s.Update(p.ID, "", &writeas.PostParams{Content: "Updated"}); err == nil {
+		t.Errorf("Update without token or login should fail")
+	}
+
+	if _, err = s.Collections(); err != ErrNotLoggedIn {
+		t.Errorf("Expected ErrNotLoggedIn, got %v", err)
+	}
+	if _, err = s.LogIn("matt", "secret"); err != nil {
+		t.Fatalf("Log in failed: %v", err)
+	}
+
+	results, err := s.Claim(s.LocalPosts())
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ErrorMessage != "" {
+		t.Errorf("Unexpected claim results: %+v", results)
+	}
+	if local := s.LocalPosts(); len(local) != 0 {
+		t.Errorf("Claimed post wasn't removed locally: %v", local)
+	}
+
+	p, err = s.Publish(&writeas.PostParams{Title: "On the blog", Content: "Hi", Collection: "blog"})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if url := s.PostURL(p); url != srv.URL+"/blog/on-the-blog" {
+		t.Errorf("Unexpected post URL %s", url)
+	}
+
+	postsDir := t.TempDir()
+	pulled, err := s.Pull(postsDir)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(pulled) != 2 {
+		t.Fatalf("Expected 2 posts pulled, got %d", len(pulled))
+	}
+	for _, r := range pulled {
+		if r.Err != nil {
+			t.Errorf("Couldn't pull %s: %v", r.ID, r.Err)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(postsDir, "blog", "on-the-blog.txt"))
+	if err != nil || string(b) != "# On the blog\n\nHi" {
+		t.Errorf("Blog post wasn't pulled: %q, %v", b, err)
+	}
+
+	if err = s.LogOut(); err != nil {
+		t.Errorf("Log out failed: %v", err)
+	}
+	if s.LoggedIn() {
+		t.Errorf("Session still logged in")
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	statsFile = "stats.json"
+	// maxStatsSnapshots is how many snapshots are kept for each user. Older
+	// ones are dropped as new ones are saved.
+	maxStatsSnapshots = 100
+)
+
+// statsSnapshot is the view counts of a user's posts at one time.
+type statsSnapshot struct {
+	Time  time.Time        `json:"time"`
+	User  string           `json:"user"`
+	Views map[string]int64 `json:"views"`
+}
+
+// StatsQuery is which posts to report on, and how.
+type StatsQuery struct {
+	// Blog, if given, keeps only posts on the blog with this alias.
+	Blog string
+	// Since, unless zero, keeps only posts published since then.
+	Since time.Time
+	// Trend compares view counts with the last saved snapshot.
+	Trend bool
+	// Snapshot saves the view counts of all of the user's posts, for later
+	// runs to compare with.
+	Snapshot bool
+}
+
+// PostStats is how many times a post has been viewed.
+type PostStats struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Blog    string    `json:"blog,omitempty"`
+	Created time.Time `json:"created"`
+	Views   int64     `json:"views"`
+	// Change is how many more views the post has had since the snapshot it's
+	// compared with. Posts published since then count all of their views.
+	// It's nil unless there was a snapshot to compare with, so a post with no
+	// new views still has a change of 0.
+	Change *int64 `json:"change,omitempty"`
+}
+
+// BlogStats totals the views of the posts on a blog. Blog is empty for posts
+// that aren't on one.
+type BlogStats struct {
+	Blog   string `json:"blog"`
+	Posts  int    `json:"posts"`
+	Views  int64  `json:"views"`
+	Change *int64 `json:"change,omitempty"`
+}
+
+// Stats is a report of the views of the user's posts, most viewed first, or
+// with the most new views first when comparing with a snapshot.
+type Stats struct {
+	Time  time.Time   `json:"time"`
+	Posts []PostStats `json:"posts"`
+	Blogs []BlogStats `json:"blogs"`
+	// TotalPosts and TotalViews cover every post reported, and Change their
+	// new views.
+	TotalPosts int    `json:"total_posts"`
+	TotalViews int64  `json:"total_views"`
+	Change     *int64 `json:"change,omitempty"`
+	// Since is when the snapshot compared with was taken. It's nil if there
+	// was no comparison, or no earlier snapshot to compare with.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// PostStats reports the view counts of the authenticated user's posts.
+func (s *Session) PostStats(q StatsQuery) (*Stats, error) {
+	posts, err := s.RemotePosts(false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	views := map[string]int64{}
+	for _, p := range posts {
+		views[p.ID] = p.Views
+	}
+
+	var last *statsSnapshot
+	if q.Trend || q.Snapshot {
+		snapshots, err := s.loadStats()
+		if err != nil {
+			return nil, err
+		}
+		for i := len(snapshots) - 1; i >= 0 && q.Trend; i-- {
+			if snapshots[i].User == s.opts.User {
+				last = &snapshots[i]
+				break
+			}
+		}
+		if q.Snapshot {
+			if err := s.addStatsSnapshot(statsSnapshot{Time: now, User: s.opts.User, Views: views}); err != nil {
+				return nil, fmt.Errorf("Couldn't save stats snapshot: %v", err)
+			}
+		}
+	}
+
+	st := &Stats{Time: now, Posts: []PostStats{}, Blogs: []BlogStats{}}
+	if last != nil {
+		st.Since = &last.Time
+		st.Change = new(int64)
+	}
+	blogs := map[string]*BlogStats{}
+	for _, p := range posts {
+		if (q.Blog != "" && p.Collection != q.Blog) || (!q.Since.IsZero() && p.Created.Before(q.Since)) {
+			continue
+		}
+		ps := PostStats{
+			ID:      p.ID,
+			Title:   p.Title,
+			Blog:    p.Collection,
+			Created: p.Created,
+			Views:   p.Views,
+		}
+		if ps.Title == "" {
+			ps.Title = strings.SplitN(p.Excerpt, "\n", 2)[0]
+		}
+		if last != nil {
+			change := p.Views - last.Views[p.ID]
+			ps.Change = &change
+		}
+		st.Posts = append(st.Posts, ps)
+
+		b, ok := blogs[p.Collection]
+		if !ok {
+			b = &BlogStats{Blog: p.Collection}
+			if last != nil {
+				b.Change = new(int64)
+			}
+			blogs[p.Collection] = b
+		}
+		b.Posts++
+		b.Views += ps.Views
+		st.TotalPosts++
+		st.TotalViews += ps.Views
+		if ps.Change != nil {
+			*b.Change += *ps.Change
+			*st.Change += *ps.Change
+		}
+	}
+	for _, b := range blogs {
+		st.Blogs = append(st.Blogs, *b)
+	}
+
+	byChange := last != nil
+	sort.Slice(st.Posts, func(i, j int) bool {
+		a, b := st.Posts[i], st.Posts[j]
+		if byChange && *a.Change != *b.Change {
+			return *a.Change > *b.Change
+		}
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(st.Blogs, func(i, j int) bool {
+		a, b := st.Blogs[i], st.Blogs[j]
+		if byChange && *a.Change != *b.Change {
+			return *a.Change > *b.Change
+		}
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		return a.Blog < b.Blog
+	})
+	return st, nil
+}
+
+func (s *Session) statsPath() string {
+	return filepath.Join(s.opts.DataDir, statsFile)
+}
+
+// loadStats returns the saved snapshots, oldest first.
+func (s *Session) loadStats() ([]statsSnapshot, error) {
+	snapshots := []statsSnapshot{}
+	b, err := ioutil.ReadFile(s.statsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snapshots, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &snapshots); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", statsFile, err)
+	}
+	return snapshots, nil
+}
+
+// addStatsSnapshot saves the given snapshot with the others, dropping the
+// oldest of any user with more than maxStatsSnapshots. The snapshots are read
+// again while holding a lock, so ones saved by other runs aren't lost.
+func (s *Session) addStatsSnapshot(snap statsSnapshot) error {
+	unlock, err := s.lockDataFile(statsFile, "Stats file")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshots, err := s.loadStats()
+	if err != nil {
+		return err
+	}
+	snapshots = append(snapshots, snap)
+	count := map[string]int{}
+	kept := []statsSnapshot{}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if count[snapshots[i].User]++; count[snapshots[i].User] <= maxStatsSnapshots {
+			kept = append([]statsSnapshot{snapshots[i]}, kept...)
+		}
+	}
+	b, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeDataFile(statsFile, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
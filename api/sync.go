@@ -1,139 +1,80 @@
 package api
 
 import (
-	//"github.com/writeas/writeas-cli/sync"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
-	"github.com/writeas/writeas-cli/config"
-	"github.com/writeas/writeas-cli/executable"
+	writeas "github.com/writeas/go-writeas/v2"
 	"github.com/writeas/writeas-cli/fileutils"
-	"github.com/writeas/writeas-cli/log"
-	cli "gopkg.in/urfave/cli.v1"
 )
 
-const (
-	PostFileExt  = ".txt"
-	userFilename = "writeas_user"
-)
+const PostFileExt = ".txt"
 
-func CmdPull(c *cli.Context) error {
-	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
-	if err != nil {
-		return err
-	}
-	// Create posts directory if needed
-	if cfg.Posts.Directory == "" {
-		syncSetUp(c, cfg)
-	}
-
-	cl, err := newClient(c)
-	if err != nil {
-		return err
-	}
+// PullResult is the outcome of saving a single post during a pull.
+type PullResult struct {
+	ID string
+	// Filename is the post's file, relative to the posts directory.
+	Filename string
+	Err      error
+}
 
-	u, _ := config.LoadUser(c)
-	if u != nil {
-		cl.SetToken(u.AccessToken)
-	} else {
-		return fmt.Errorf("Not currently logged in. Authenticate with: " + executable.Name() + " auth <username>")
+// PostFilename returns the path of the file a post is saved to, relative to
+// the posts directory. Posts on a blog go in a directory named for the blog.
+func PostFilename(p *writeas.Post) string {
+	if p.Collection != nil {
+		return filepath.Join(p.Collection.Alias, p.Slug+PostFileExt)
 	}
+	return p.ID + PostFileExt
+}
 
-	// Fetch posts
-	posts, err := cl.GetUserPosts()
+// Pull saves all of the authenticated user's posts as text files in the given
+// directory, creating a directory for each blog. Failing to save a post
+// doesn't stop the others from being saved; check each result's Err.
+func (s *Session) Pull(dir string) ([]PullResult, error) {
+	posts, err := s.UserPosts()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, p := range *posts {
-		postFilename := p.ID
-		collDir := ""
-		if p.Collection != nil {
-			postFilename = p.Slug
-			// Create directory for collection
-			collDir = p.Collection.Alias
-			if !fileutils.Exists(filepath.Join(cfg.Posts.Directory, collDir)) {
-				log.Info(c, "Creating folder "+collDir)
-				err = os.Mkdir(filepath.Join(cfg.Posts.Directory, collDir), 0755)
-				if err != nil {
-					log.Errorln("Error creating blog directory %s: %s. Skipping post %s.", collDir, err, postFilename)
-					continue
-				}
-			}
+	results := make([]PullResult, 0, len(posts))
+	pulled := []string{}
+	for i := range posts {
+		p := &posts[i]
+		r := PullResult{
+			ID:       p.ID,
+			Filename: PostFilename(p),
 		}
-		postFilename += PostFileExt
-
-		// Write file
-		txtFile := p.Content
-		if p.Title != "" {
-			txtFile = "# " + p.Title + "\n\n" + txtFile
-		}
-		err = ioutil.WriteFile(filepath.Join(cfg.Posts.Directory, collDir, postFilename), []byte(txtFile), 0644)
-		if err != nil {
-			log.Errorln("Error creating file %s: %s", postFilename, err)
-		}
-		log.Info(c, "Saved post "+postFilename)
-
-		// Update mtime and atime on files
-		modTime := p.Updated.Local()
-		err = os.Chtimes(filepath.Join(cfg.Posts.Directory, collDir, postFilename), modTime, modTime)
-		if err != nil {
-			log.Errorln("Error setting time on %s: %s", postFilename, err)
+		r.Err = s.pullPost(dir, p)
+		results = append(results, r)
+		if r.Err == nil {
+			pulled = append(pulled, r.Filename)
 		}
 	}
-
-	return nil
+	s.reindexFiles(dir, pulled)
+	return results, nil
 }
 
-func syncSetUp(c *cli.Context, cfg *config.Config) error {
-	// Get user information and fail early (before we make the user do
-	// anything), if we're going to
-	u, err := config.LoadUser(c)
-	if err != nil {
-		return err
-	}
-
-	// Prompt for posts directory
-	defaultDir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	var dir string
-	fmt.Printf("Posts directory? [%s]: ", defaultDir)
-	fmt.Scanln(&dir)
-	if dir == "" {
-		dir = defaultDir
-	}
-
-	// FIXME: This only works on non-Windows OSes (fix: https://www.reddit.com/r/golang/comments/5t3ezd/hidden_files_directories/)
-	userFilepath := filepath.Join(dir, "."+userFilename)
-
-	// Create directory if needed
-	if !fileutils.Exists(dir) {
-		err = os.MkdirAll(dir, 0700)
-		if err != nil {
-			if config.Debug() {
-				log.Errorln("Error creating data directory: %s", err)
+func (s *Session) pullPost(dir string, p *writeas.Post) error {
+	if p.Collection != nil {
+		collDir := filepath.Join(dir, p.Collection.Alias)
+		if !fileutils.Exists(collDir) {
+			s.logf("Creating folder %s", p.Collection.Alias)
+			if err := os.Mkdir(collDir, 0755); err != nil {
+				return fmt.Errorf("Error creating blog directory %s: %s", p.Collection.Alias, err)
 			}
-			return err
 		}
-		// Create username file in directory
-		err = ioutil.WriteFile(userFilepath, []byte(u.User.Username), 0644)
-		fmt.Println("Created posts directory.")
 	}
 
-	// Save preference
-	cfg.Posts.Directory = dir
-	err = config.SaveConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]), cfg)
-	if err != nil {
-		if config.Debug() {
-			log.Errorln("Unable to save config: %s", err)
-		}
-		return err
+	if err := WritePost(dir, p); err != nil {
+		return fmt.Errorf("Error creating file: %s", err)
 	}
-	fmt.Println("Saved config.")
 
+	// Update mtime and atime on files
+	modTime := p.Updated.Local()
+	if err := os.Chtimes(filepath.Join(dir, PostFilename(p)), modTime, modTime); err != nil {
+		return fmt.Errorf("Error setting time: %s", err)
+	}
+	s.rememberVersion(p, PostFilename(p))
 	return nil
 }
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// hashtagReg matches hashtags the way WriteFreely finds them: a # that isn't
+// in the middle of a word, then letters, numbers and underscores, with at
+// least one letter.
+var hashtagReg = regexp.MustCompile(`(?:^|[^&\pL\pM\p{Nd}_])[#＃]([\pL\pM\p{Nd}_]*[\pL\pM][\pL\pM\p{Nd}_]*)`)
+
+// PostTags returns the hashtags in the given post content, in lowercase,
+// without duplicates, in the order they first appear.
+func PostTags(content string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, m := range hashtagReg.FindAllStringSubmatchIndex(content, -1) {
+		// Like WriteFreely, skip anything that runs into another # or a URL
+		if rest := content[m[1]:]; strings.HasPrefix(rest, "#") || strings.HasPrefix(rest, "＃") || strings.HasPrefix(rest, "://") {
+			continue
+		}
+		tag := strings.ToLower(content[m[2]:m[3]])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasTags returns whether all of the wanted tags are among the given ones.
+func hasTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, t := range tags {
+			if t == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// appendTags adds the given tags to the end of the post content as
+// hashtags, leaving out any it already has.
+func appendTags(content string, tags []string) string {
+	have := PostTags(content)
+	missing := []string{}
+	for _, t := range tags {
+		t = strings.TrimLeft(t, "#")
+		if t != "" && !hasTags(have, []string{strings.ToLower(t)}) {
+			missing = append(missing, "#"+t)
+			have = append(have, strings.ToLower(t))
+		}
+	}
+	if len(missing) == 0 {
+		return content
+	}
+	return strings.TrimRight(content, "\n") + "\n\n" + strings.Join(missing, " ") + "\n"
+}
+
+// TagCount is a tag, and how many posts have it.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// CountTags returns every tag in the given posts, with how many of them have
+// it, most used first.
+func CountTags(posts []writeas.Post) []TagCount {
+	counts := map[string]int{}
+	for _, p := range posts {
+		for _, t := range PostTags(p.Content) {
+			counts[t]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, TagCount{Tag: t, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+func TestPostTags(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Content string
+		Tags    []string
+	}{
+		{"Simple", "Off to the beach. #travel #Photos", []string{"travel", "photos"}},
+		{"Start of post", "#work starts here", []string{"work"}},
+		{"Duplicates", "#Work, then #work again", []string{"work"}},
+		{"Underscores and numbers", "#road_trip2020", []string{"road_trip2020"}},
+		{"Unicode", "#café and #東京", []string{"café", "東京"}},
+		{"Fullwidth sign", "＃fullwidth", []string{"fullwidth"}},
+		{"Inside word", "a#b and C#", []string{}},
+		{"Only numbers", "#123 and #2020", []string{}},
+		{"Heading", "# Heading\n\nText", []string{}},
+		{"Entity", "&#39;s", []string{}},
+		{"Runs into hash", "#one#two", []string{}},
+		{"URL", "#http://example.com", []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := PostTags(tc.Content)
+			if !reflect.DeepEqual(out, tc.Tags) {
+				t.Errorf("Incorrect output, expecting %v but got %v", tc.Tags, out)
+			}
+		})
+	}
+}
+
+func TestAppendTags(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Content string
+		Tags    []string
+		Result  string
+	}{
+		{"None", "Hello.\n", nil, "Hello.\n"},
+		{"New", "Hello.\n\n", []string{"travel", "#photos"}, "Hello.\n\n#travel #photos\n"},
+		{"Already there", "Hello. #Travel", []string{"travel", "photos", "Photos"}, "Hello. #Travel\n\n#photos\n"},
+		{"All there", "Hello. #travel", []string{"travel"}, "Hello. #travel"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			out := appendTags(tc.Content, tc.Tags)
+			if out != tc.Result {
+				t.Errorf("Incorrect output, expecting %q but got %q", tc.Result, out)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tt := []struct {
+		Value string
+		Tags  []string
+	}{
+		{"travel, photos", []string{"travel", "photos"}},
+		{"#travel #photos", []string{"travel", "photos"}},
+		{`["travel", "photos"]`, []string{"travel", "photos"}},
+		{"", []string{}},
+	}
+
+	for _, tc := range tt {
+		if out := parseTags(tc.Value); !reflect.DeepEqual(out, tc.Tags) {
+			t.Errorf("parseTags(%q): expecting %v but got %v", tc.Value, tc.Tags, out)
+		}
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	posts := []writeas.Post{
+		{Content: "#work #ideas"},
+		{Content: "#work"},
+		{Content: "#travel and #Work"},
+	}
+	expected := []TagCount{{"work", 3}, {"ideas", 1}, {"travel", 1}}
+	if out := CountTags(posts); !reflect.DeepEqual(out, expected) {
+		t.Errorf("Incorrect output, expecting %v but got %v", expected, out)
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+)
+
+// torSession identifies this run of the program to the Tor SOCKS proxy, so
+// that each command gets its own circuits.
+var torSession = newTorSession()
+
+func newTorSession() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// torIsolationAuth returns SOCKS credentials that isolate requests for the
+// given host and user from those for any other account, and from other runs
+// of the program. Tor keeps streams with different SOCKS credentials on
+// separate circuits (see IsolateSOCKSAuth in tor(1)). The account is hashed so
+// it isn't revealed to the proxy.
+func torIsolationAuth(host, user string) *url.Userinfo {
+	h := sha256.Sum256([]byte(host + "\x00" + user))
+	return url.UserPassword(hex.EncodeToString(h[:8]), torSession)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// socksRequest is what the stand-in SOCKS proxy saw for one connection.
+type socksRequest struct {
+	User, Pass string
+	Target     string
+}
+
+// fakeSOCKS is a minimal SOCKS5 proxy that requires username/password auth,
+// records the credentials and target of each connection, then answers any
+// HTTP request itself instead of connecting onward.
+type fakeSOCKS struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	reqs []socksRequest
+}
+
+func newFakeSOCKS(t *testing.T) *fakeSOCKS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSOCKS{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSOCKS) Addr() string { return s.ln.Addr().String() }
+
+func (s *fakeSOCKS) Close() { s.ln.Close() }
+
+func (s *fakeSOCKS) Requests() []socksRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]socksRequest{}, s.reqs...)
+}
+
+func (s *fakeSOCKS) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Greeting: require username/password authentication
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(r, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 2})
+
+	// Authentication
+	var req socksRequest
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return
+	}
+	user := make([]byte, hdr[1])
+	io.ReadFull(r, user)
+	plen, _ := r.ReadByte()
+	pass := make([]byte, plen)
+	io.ReadFull(r, pass)
+	req.User, req.Pass = string(user), string(pass)
+	conn.Write([]byte{1, 0})
+
+	// Connect request
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return
+	}
+	var host string
+	switch head[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(r, ip)
+		host = net.IP(ip).String()
+	case 3:
+		l, _ := r.ReadByte()
+		name := make([]byte, l)
+		io.ReadFull(r, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+	req.Target = fmt.Sprintf("%s:%d", host, binary.BigEndian.Uint16(port))
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	s.mu.Lock()
+	s.reqs = append(s.reqs, req)
+	s.mu.Unlock()
+
+	// Answer the HTTP request as if we were the onion service
+	if _, err := http.ReadRequest(r); err != nil {
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+}
+
+func TestTorStreamIsolation(t *testing.T) {
+	proxy := newFakeSOCKS(t)
+	defer proxy.Close()
+
+	onion := "http://writeas7pm7rcdqg.onion"
+	get := func(user string) {
+		cl, err := newHTTPClient(httpOptions{
+			TorSOCKS: proxy.Addr(),
+			TorAuth:  torIsolationAuth(onion, user),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cl.Get(onion + "/api/me")
+		if err != nil {
+			t.Fatalf("Request through SOCKS proxy failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	get("alice")
+	get("bob")
+	get("alice")
+
+	reqs := proxy.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 connections through the proxy, got %d", len(reqs))
+	}
+	for _, r := range reqs {
+		if r.Target != "writeas7pm7rcdqg.onion:80" {
+			t.Errorf("Onion address should be resolved by the proxy, but target was %s", r.Target)
+		}
+		if r.Pass != torSession {
+			t.Errorf("Expected password to identify this session, got %q", r.Pass)
+		}
+	}
+	if reqs[0].User == reqs[1].User {
+		t.Errorf("Different accounts share SOCKS credentials %q", reqs[0].User)
+	}
+	if reqs[0].User != reqs[2].User {
+		t.Errorf("Same account got different SOCKS credentials: %q and %q", reqs[0].User, reqs[2].User)
+	}
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRetryWait is the longest we'll wait between attempts, whether from our
+// own backoff or a server's Retry-After header.
+const maxRetryWait = time.Minute
+
+// httpOptions configures the HTTP client used for API requests.
+type httpOptions struct {
+	// Timeout applies to each attempt at a request, not to all attempts
+	// together.
+	Timeout time.Duration
+	// Retries is the number of times a request is retried after the first
+	// attempt fails.
+	Retries int
+	// RetryWait is how long to wait before the first retry. It doubles with
+	// each following attempt.
+	RetryWait time.Duration
+	// TorSOCKS, if set, is the host:port of the Tor SOCKS proxy to route
+	// requests through.
+	TorSOCKS string
+	// TorAuth, if set, is sent to the Tor SOCKS proxy so that requests with
+	// different credentials use different circuits.
+	TorAuth *url.Userinfo
+	// Proxy is the URL of an http, https, or socks5 proxy to route requests
+	// through. If it and TorSOCKS are both empty, the usual proxy environment
+	// variables apply.
+	Proxy string
+
+	// CACert is the path to a PEM file of certificate authorities to trust in
+	// addition to the system's.
+	CACert string
+	// ClientCert and ClientKey are paths to a PEM certificate and private key
+	// to present to the server.
+	ClientCert string
+	ClientKey  string
+
+	// Logf, if set, is called with diagnostic messages about retries.
+	Logf func(string, ...interface{})
+	// Trace, if set, is called after each attempt at a request.
+	Trace func(RequestTrace)
+}
+
+func newHTTPClient(opts httpOptions) (*http.Client, error) {
+	tr, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	var base http.RoundTripper = tr
+	if opts.Trace != nil {
+		base = &traceTransport{base: tr, trace: opts.Trace}
+	}
+	return &http.Client{
+		Transport: &retryTransport{
+			base: base,
+			opts: opts,
+		},
+	}, nil
+}
+
+// newTransport returns the transport that makes a single attempt at each
+// request, routed through the configured proxy with the configured TLS
+// settings.
+func newTransport(opts httpOptions) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.TorSOCKS != "" {
+		// Use socks5h so onion addresses are resolved by Tor, never locally
+		tr.Proxy = http.ProxyURL(&url.URL{Scheme: "socks5h", Host: opts.TorSOCKS, User: opts.TorAuth})
+	} else if opts.Proxy != "" {
+		u, err := parseProxy(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	if opts.CACert != "" || opts.ClientCert != "" {
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	if opts.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CA certificates: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No PEM certificates found in %s", opts.CACert)
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	if opts.ClientCert != "" {
+		key := opts.ClientKey
+		if key == "" {
+			key = opts.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load client certificate: %v", err)
+		}
+		tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tr, nil
+}
+
+// parseProxy parses and validates a proxy URL. A bare host:port is treated
+// as an HTTP proxy.
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("Unsupported proxy scheme %q. Use http, https or socks5.", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Invalid proxy URL: missing host")
+	}
+	return u, nil
+}
+
+// retryTransport is an http.RoundTripper that applies a timeout to each
+// attempt at a request, and retries requests that fail in a way that makes it
+// safe to try again: network errors and server errors for idempotent requests,
+// and rate limiting for any request.
+type retryTransport struct {
+	base http.RoundTripper
+	opts httpOptions
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("can't retry request with unrewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.roundTrip(r)
+		if attempt >= t.opts.Retries {
+			return resp, err
+		}
+
+		var wait time.Duration
+		if err != nil {
+			if !isIdempotent(req.Method) {
+				return nil, err
+			}
+			wait = t.backoff(attempt)
+			t.logf("%s %s failed: %v. Retrying in %s...", req.Method, req.URL.Path, err, wait)
+		} else if resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && isIdempotent(req.Method)) {
+			// A rate-limited request wasn't acted on, so it's safe to retry
+			// regardless of method.
+			var ok bool
+			wait, ok = retryAfter(resp, t.backoff(attempt))
+			if !ok {
+				return resp, nil
+			}
+			t.logf("%s %s failed with status %d. Retrying in %s...", req.Method, req.URL.Path, resp.StatusCode, wait)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			return resp, nil
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// roundTrip makes a single attempt at the request, subject to the configured
+// timeout.
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.opts.Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.Timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Keep the timeout in effect until the caller finishes reading the body
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns how long to wait before the given retry attempt (starting at
+// 0), including some jitter so concurrent clients don't retry in lockstep.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	wait := t.opts.RetryWait
+	for i := 0; i < attempt && wait < maxRetryWait; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func (t *retryTransport) logf(s string, p ...interface{}) {
+	if t.opts.Logf != nil {
+		t.opts.Logf(s, p...)
+	}
+}
+
+// retryAfter returns how long the server asked us to wait before retrying,
+// falling back to def if it didn't say. It returns false if the server asked
+// for a longer wait than we're willing to make.
+func retryAfter(resp *http.Response, def time.Duration) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return def, true
+	}
+	var wait time.Duration
+	if secs, err := strconv.Atoi(h); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(h); err == nil {
+		wait = time.Until(t)
+	} else {
+		return def, true
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, wait <= maxRetryWait
+}
+
+// RequestTrace describes a single attempt at an HTTP request, for debugging.
+// Access and edit tokens are never included.
+type RequestTrace struct {
+	Method string
+	// URL is the request URL with any tokens or passwords redacted.
+	URL string
+	// Status is the response status code, or 0 if there was no response.
+	Status   int
+	Duration time.Duration
+	// Err is the error from the attempt, if any, with any tokens or passwords
+	// in it redacted.
+	Err error
+}
+
+// traceTransport is an http.RoundTripper that reports on every request it
+// makes.
+type traceTransport struct {
+	base  http.RoundTripper
+	trace func(RequestTrace)
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	rt := RequestTrace{
+		Method:   req.Method,
+		URL:      redactURL(req.URL),
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		rt.Err = redactError(err)
+	} else {
+		rt.Status = resp.StatusCode
+	}
+	t.trace(rt)
+	return resp, err
+}
+
+// redactedParams are the query parameters that hold secrets.
+var redactedParams = []string{"token", "access_token", "password"}
+
+// redactURL returns the given URL as a string, with any password and secret
+// query parameters replaced.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	r := *u
+	if r.User != nil {
+		if _, ok := r.User.Password(); ok {
+			r.User = url.UserPassword(r.User.Username(), "REDACTED")
+		}
+	}
+	if r.RawQuery != "" {
+		q := r.Query()
+		for _, p := range redactedParams {
+			if _, ok := q[p]; ok {
+				q.Set(p, "REDACTED")
+			}
+		}
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
+
+// redactError returns the given error with any URL in it redacted. Transport
+// errors include the full request URL, which can hold an edit token.
+func redactError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		if u, perr := url.Parse(ue.URL); perr == nil {
+			return &url.Error{Op: ue.Op, URL: redactURL(u), Err: ue.Err}
+		}
+	}
+	return err
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+)
+
+const versionsFile = "versions.json"
+
+// postVersion is the last version of a post seen from the server, so we can
+// tell whether someone else has changed it since.
+type postVersion struct {
+	Updated time.Time `json:"updated"`
+	// File is the post's file, relative to the posts directory, if it was
+	// pulled.
+	File string `json:"file,omitempty"`
+	// Pulled is the version the file was last pulled or pushed as. Push
+	// compares with it rather than Updated, which changes whenever the post
+	// is fetched, e.g. by get or edit.
+	Pulled *pulledVersion `json:"pulled,omitempty"`
+}
+
+// pulledVersion is the version of a post its file was last pulled or pushed
+// as, and the modification time the file was given then.
+type pulledVersion struct {
+	Updated time.Time `json:"updated"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// pulled returns the version the post's file was last pulled or pushed as.
+// Posts pulled before this was recorded use the last version seen.
+func (v postVersion) pulled() pulledVersion {
+	if v.Pulled != nil {
+		return *v.Pulled
+	}
+	return pulledVersion{Updated: v.Updated, ModTime: v.Updated}
+}
+
+// ConflictError is returned when a post was changed on the server after the
+// version it's being updated from was fetched.
+type ConflictError struct {
+	ID string
+	// Known is when the version we have was last updated.
+	Known time.Time
+	// Current is the post as it is now on the server.
+	Current *writeas.Post
+}
+
+func (e *ConflictError) Error() string {
+	by := ""
+	if e.Current.OwnerName != "" {
+		by = " by " + e.Current.OwnerName
+	}
+	return fmt.Sprintf("Post %s was changed%s on %s, after the version you have from %s.", e.ID, by,
+		e.Current.Updated.Local().Format("2006-01-02 15:04:05"), e.Known.Local().Format("2006-01-02 15:04:05"))
+}
+
+func (s *Session) versionsPath() string {
+	return filepath.Join(s.opts.DataDir, versionsFile)
+}
+
+func (s *Session) loadVersions() (map[string]postVersion, error) {
+	versions := map[string]postVersion{}
+	b, err := ioutil.ReadFile(s.versionsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return versions, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", versionsFile, err)
+	}
+	return versions, nil
+}
+
+// updateVersions changes the recorded versions with the given function, while
+// holding a lock so other runs don't change them at the same time. They're
+// saved if update returns true.
+func (s *Session) updateVersions(update func(map[string]postVersion) bool) error {
+	unlock, err := s.lockDataFile(versionsFile, "Post versions file")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	versions, err := s.loadVersions()
+	if err != nil {
+		return err
+	}
+	if !update(versions) {
+		return nil
+	}
+	b, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeDataFile(versionsFile, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// rememberVersion records the version of the given post just seen from the
+// server. Giving the file it was just pulled or pushed from, relative to the
+// posts directory, also makes this the version that file is pushed from;
+// without one, any file already recorded for it is kept. Posts the server
+// didn't give an updated time for are forgotten, since they can't be checked.
+func (s *Session) rememberVersion(p *writeas.Post, file string) {
+	s.recordVersion(p, file, true)
+}
+
+// rememberReadVersion records the version of the given post just read, but
+// only if it's one the user can edit, or one already tracked, like a pulled
+// post. That keeps reading other people's posts from filling up the file.
+func (s *Session) rememberReadVersion(p *writeas.Post) {
+	if s.opts.DataDir == "" {
+		return
+	}
+	owned := s.TokenFromID(p.ID) != "" || (s.LoggedIn() && p.OwnerName != "" && p.OwnerName == s.opts.User)
+	s.recordVersion(p, "", owned)
+}
+
+// recordVersion records the version of the given post, adding it if it isn't
+// tracked yet only if add is true.
+func (s *Session) recordVersion(p *writeas.Post, file string, add bool) {
+	if s.opts.DataDir == "" {
+		return
+	}
+	err := s.updateVersions(func(versions map[string]postVersion) bool {
+		v, ok := versions[p.ID]
+		if p.Updated.IsZero() {
+			if !ok {
+				return false
+			}
+			delete(versions, p.ID)
+			return true
+		}
+		if !ok && !add {
+			return false
+		}
+		v.Updated = p.Updated
+		if file != "" {
+			v.File = file
+			v.Pulled = &pulledVersion{Updated: p.Updated, ModTime: p.Updated.Local()}
+		}
+		versions[p.ID] = v
+		return true
+	})
+	if err != nil {
+		s.logf("Couldn't remember version of %s: %v", p.ID, err)
+	}
+}
+
+// forgetVersion stops tracking the given post, once it's been deleted.
+func (s *Session) forgetVersion(friendlyID string) {
+	if s.opts.DataDir == "" {
+		return
+	}
+	err := s.updateVersions(func(versions map[string]postVersion) bool {
+		if _, ok := versions[friendlyID]; !ok {
+			return false
+		}
+		delete(versions, friendlyID)
+		return true
+	})
+	if err != nil {
+		s.logf("Couldn't forget version of %s: %v", friendlyID, err)
+	}
+}
+
+// PulledFile returns the file the given post was pulled to, relative to the
+// posts directory, or an empty string if it wasn't pulled.
+func (s *Session) PulledFile(friendlyID string) string {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return ""
+	}
+	return versions[friendlyID].File
+}
+
+// CheckVersion returns a *ConflictError if the given post has changed on the
+// server since it was last fetched, published or updated here. Posts we
+// haven't seen before can't be checked, so they pass.
+func (s *Session) CheckVersion(friendlyID string) error {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return err
+	}
+	known, ok := versions[friendlyID]
+	if !ok {
+		return nil
+	}
+	return s.checkUpdated(friendlyID, known.Updated)
+}
+
+// checkUpdated returns a *ConflictError if the given post was changed on the
+// server after the given time.
+func (s *Session) checkUpdated(friendlyID string, known time.Time) error {
+	cl, rec := s.userClient()
+	p, err := cl.GetPost(friendlyID)
+	if err != nil {
+		return newError(err, rec.status, err.Error())
+	}
+	if p.Updated.After(known) {
+		return &ConflictError{ID: friendlyID, Known: known, Current: p}
+	}
+	return nil
+}
+
+// PushResult is the outcome of sending a single file during a push.
+type PushResult struct {
+	ID string
+	// Filename is the post's file, relative to the posts directory.
+	Filename string
+	Err      error
+}
+
+// Push updates each pulled post whose file in the given directory has been
+// changed since it was pulled. Unless force is true, posts that were also
+// changed on the server are skipped with a *ConflictError. Failing to push a
+// post doesn't stop the others from being pushed; check each result's Err.
+func (s *Session) Push(dir string, force bool) ([]PushResult, error) {
+	if !s.LoggedIn() {
+		return nil, ErrNotLoggedIn
+	}
+	versions, err := s.loadVersions()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(versions))
+	for id, v := range versions {
+		if v.File != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return versions[ids[i]].File < versions[ids[j]].File })
+
+	results := []PushResult{}
+	pushed := []string{}
+	for _, id := range ids {
+		v := versions[id]
+		pulled := v.pulled()
+		path := filepath.Join(dir, v.File)
+		fi, err := os.Stat(path)
+		if err != nil || !fi.ModTime().After(pulled.ModTime) {
+			// Unchanged, or removed locally
+			continue
+		}
+		r := PushResult{
+			ID:       id,
+			Filename: v.File,
+			Err:      s.pushPost(dir, v.File, id, pulled.Updated, force),
+		}
+		results = append(results, r)
+		if r.Err == nil {
+			pushed = append(pushed, r.Filename)
+		}
+	}
+	s.reindexFiles(dir, pushed)
+	return results, nil
+}
+
+// pushPost updates the given post from its file, unless it was changed on the
+// server after the version the file was pulled or last pushed as.
+func (s *Session) pushPost(dir, file, id string, pulled time.Time, force bool) error {
+	path := filepath.Join(dir, file)
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading file: %s", err)
+	}
+	if !force {
+		if err := s.checkUpdated(id, pulled); err != nil {
+			return err
+		}
+	}
+
+	pp := &writeas.PostParams{}
+	pp.Title, pp.Content = posts.ExtractTitle(string(text))
+	p, err := s.Update(id, "", pp)
+	if err != nil {
+		return err
+	}
+
+	// Match the file's time to the new version, so it isn't pushed again
+	if !p.Updated.IsZero() {
+		modTime := p.Updated.Local()
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return fmt.Errorf("Error setting time: %s", err)
+		}
+	}
+	s.rememberVersion(p, file)
+	return nil
+}
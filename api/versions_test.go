@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+func TestRememberReadVersion(t *testing.T) {
+	s, err := NewSession(Options{Host: "https://example.com", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Now().UTC().Truncate(time.Second)
+
+	// Other people's posts aren't tracked
+	s.rememberReadVersion(&writeas.Post{ID: "theirs", Updated: seen, OwnerName: "bob"})
+	if versions, _ := s.loadVersions(); len(versions) != 0 {
+		t.Errorf("Expected no versions for a post read anonymously, got %v", versions)
+	}
+
+	// Pulled posts are, without moving the version they're pushed from
+	s.rememberVersion(&writeas.Post{ID: "pulled", Updated: seen}, "pulled.txt")
+	later := seen.Add(time.Hour)
+	s.rememberReadVersion(&writeas.Post{ID: "pulled", Updated: later})
+	versions, err := s.loadVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := versions["pulled"]
+	if !v.Updated.Equal(later) || v.File != "pulled.txt" || !v.pulled().Updated.Equal(seen) {
+		t.Errorf("Unexpected version of pulled post: %+v", v)
+	}
+}
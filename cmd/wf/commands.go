@@ -9,7 +9,6 @@ import (
 	"text/tabwriter"
 
 	"github.com/hashicorp/go-multierror"
-	"github.com/writeas/writeas-cli/api"
 	"github.com/writeas/writeas-cli/commands"
 	"github.com/writeas/writeas-cli/config"
 	"github.com/writeas/writeas-cli/executable"
@@ -23,7 +22,7 @@ func requireAuth(f cli.ActionFunc, action string) cli.ActionFunc {
 		if c.GlobalIsSet("host") && !c.GlobalIsSet("user") {
 			// multiple users should display a list
 			if num, users, err := usersLoggedIn(c); num > 1 && err == nil {
-				return cli.NewExitError(fmt.Sprintf("Multiple logged in users, please use '-u' or '-user' to specify one of:\n%s", strings.Join(users, ", ")), 1)
+				return cli.NewExitError(fmt.Sprintf("Multiple logged in users, please use '-u' or '-user' to specify one of:\n%s", strings.Join(users, ", ")), commands.ExitUsage)
 			} else if num == 1 && err == nil {
 				// single user found for host should be set as user flag so LoadUser can
 				// succeed, and notify the client
@@ -56,7 +55,7 @@ func requireAuth(f cli.ActionFunc, action string) cli.ActionFunc {
 				if err != nil {
 					return cli.NewExitError(fmt.Sprintf("Failed to check for logged in users: %v", err), 1)
 				} else if num > 0 {
-					return cli.NewExitError("You are authenticated, but have no default user/host set. Supply -user and -host flags.", 1)
+					return cli.NewExitError("You are authenticated, but have no default user/host set. Supply -user and -host flags.", commands.ExitUsage)
 				}
 			}
 		}
@@ -65,7 +64,7 @@ func requireAuth(f cli.ActionFunc, action string) cli.ActionFunc {
 			return cli.NewExitError(fmt.Sprintf("Couldn't load user: %v", err), 1)
 		}
 		if u == nil {
-			return cli.NewExitError("You must be authenticated to "+action+".\nLog in first with: "+executable.Name()+" auth <username>", 1)
+			return cli.NewExitError("You must be authenticated to "+action+".\nLog in first with: "+executable.Name()+" auth <username>", commands.ExitNotLoggedIn)
 		}
 
 		return f(c)
@@ -81,6 +80,10 @@ func usersLoggedIn(c *cli.Context) (int, []string, error) {
 	}
 	dir, err := os.Open(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			// Nobody has logged in to this host yet
+			return 0, nil, nil
+		}
 		return 0, nil, err
 	}
 	contents, err := dir.Readdir(0)
@@ -146,17 +149,15 @@ func cmdAuth(c *cli.Context) error {
 	// Update config if this is user's first auth
 	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
 	if err != nil {
-		log.Errorln("Not saving config. Unable to load config: %s", err)
-		return err
+		return cli.NewExitError(fmt.Sprintf("Not saving config. Unable to load config: %v", err), commands.ExitError)
 	}
 	if cfg.Default.Host == "" && cfg.Default.User == "" {
 		// This is user's first auth, so save defaults
-		cfg.Default.Host = api.HostURL(c)
+		cfg.Default.Host = config.HostURL(c)
 		cfg.Default.User = username
 		err = config.SaveConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]), cfg)
 		if err != nil {
-			log.Errorln("Not saving config. Unable to save config: %s", err)
-			return err
+			return cli.NewExitError(fmt.Sprintf("Not saving config. Unable to save config: %v", err), commands.ExitError)
 		}
 		fmt.Printf("Set %s on %s as default account.\n", username, c.GlobalString("host"))
 	}
@@ -173,15 +174,13 @@ func cmdLogOut(c *cli.Context) error {
 	// Remove this from config if it's the default account
 	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
 	if err != nil {
-		log.Errorln("Not updating config. Unable to load: %s", err)
-		return err
+		return cli.NewExitError(fmt.Sprintf("Not updating config. Unable to load: %v", err), commands.ExitError)
 	}
 	username, err := config.CurrentUser(c)
 	if err != nil {
-		log.Errorln("Not updating config. Unable to load current user: %s", err)
-		return err
+		return cli.NewExitError(fmt.Sprintf("Not updating config. Unable to load current user: %v", err), commands.ExitError)
 	}
-	reqHost := api.HostURL(c)
+	reqHost := config.HostURL(c)
 	if reqHost == "" {
 		// No --host given, so we're using the default host
 		reqHost = cfg.Default.Host
@@ -192,8 +191,7 @@ func cmdLogOut(c *cli.Context) error {
 		cfg.Default.User = ""
 		err = config.SaveConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]), cfg)
 		if err != nil {
-			log.Errorln("Not updating config. Unable to save config: %s", err)
-			return err
+			return cli.NewExitError(fmt.Sprintf("Not updating config. Unable to save config: %v", err), commands.ExitError)
 		}
 	}
 
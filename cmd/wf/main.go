@@ -9,17 +9,22 @@ import (
 )
 
 func main() {
+	app := newApp()
+	config.DirMustExist(config.UserDataDir(app.ExtraInfo()["configDir"]))
+	app.Run(os.Args)
+}
+
+// newApp sets up the command-line app.
+func newApp() *cli.App {
 	appInfo := map[string]string{
 		"configDir": configDir,
 		"version":   "1.0",
 	}
-	config.DirMustExist(config.UserDataDir(appInfo["configDir"]))
 	cli.VersionFlag = cli.BoolFlag{
 		Name:  "version, V",
 		Usage: "print the version",
 	}
 
-	// Run the app
 	app := cli.NewApp()
 	app.Name = "wf"
 	app.Version = appInfo["version"]
@@ -35,7 +40,9 @@ func main() {
 		return appInfo
 	}
 	app.Action = requireAuth(commands.CmdPost, "publish")
-	app.Flags = append(config.PostFlags, flags...)
+	app.Flags = append(append(append(config.PostFlags, config.NetworkFlags...), config.LogFlags...), flags...)
+	app.Before = commands.InitLogging
+	app.After = commands.CloseLogging
 	app.Commands = []cli.Command{
 		{
 			Name:   "post",
@@ -45,7 +52,8 @@ func main() {
 			Description: `Create a new post on WriteFreely from stdin.
 
    Use the --code flag to indicate that the post should use syntax 
-   highlighting. Or use the --font [value] argument to set the post's 
+   highlighting, or --code=<lang> (e.g. --code=go) to highlight it as that
+   language. Or use the --font [value] argument to set the post's 
    appearance, where [value] is mono, monospace (default), wrap (monospace 
    font with word wrapping), serif, or sans.`,
 		},
@@ -54,31 +62,62 @@ func main() {
 			Usage: "Compose a new post from the command-line and publish",
 			Description: `An alternative to piping data to the program.
 
-   On Windows, this will use 'copy con' to start reading what you input from the
-   prompt. Press F6 or Ctrl-Z then Enter to end input.
-   On *nix, this will use the best available text editor, starting with the 
-   value set to the WRITEAS_EDITOR or EDITOR environment variable, or vim, or
-   finally nano.
+   This uses the editor set in the WRITEAS_EDITOR environment variable, the
+   editor setting in the [posts] section of config.ini, or the VISUAL or EDITOR
+   environment variable, in that order. The editor may include arguments, like
+   "code --wait". Otherwise, on *nix, the first of vim, nano, vi, micro or
+   emacs that's installed is used. On Windows, 'copy con' reads what you input
+   at the prompt; press F6 or Ctrl-Z then Enter to end input.
 
    Use the --code flag to indicate that the post should use syntax 
-   highlighting. Or use the --font [value] argument to set the post's 
+   highlighting, or --code=<lang> (e.g. --code=go) to highlight it as that
+   language. Or use the --font [value] argument to set the post's 
    appearance, where [value] is mono, monospace (default), wrap (monospace 
    font with word wrapping), serif, or sans.
    
-   If posting fails for any reason, 'wf' will show you the temporary file
-   location and how to pipe it to 'wf' to retry.`,
+   What you write is saved as a draft until it's published, so nothing is lost
+   if posting fails or you quit. Next time, you'll be asked whether to resume
+   your last unfinished draft, if stdin is a terminal. Use --resume or
+   --no-resume to choose without being asked. See 'wf drafts' to manage them.
+
+   If the server can't be reached, the post is saved to the outbox; send it
+   later with 'wf outbox flush'.`,
 			Action: requireAuth(commands.CmdNew, "publish"),
-			Flags:  config.PostFlags,
+			Flags:  config.NewFlags,
 		},
 		{
-			Name:   "publish",
-			Usage:  "Publish a file",
+			Name:      "publish",
+			Usage:     "Publish a file",
+			ArgsUsage: "<filename>...",
+			Description: `Publishes the contents of the given file.
+
+   Code files, like main.go, are highlighted in their language, judging by the
+   file's name, unless --font is given. Use --code=<lang> to choose the
+   language yourself.
+
+   Given several files, they're combined into one post, with each file under
+   a heading of its name, in a code block highlighted in its language. Use
+   --separate to publish each file as a post of its own instead.`,
 			Action: requireAuth(commands.CmdPublish, "publish"),
-			Flags:  config.PostFlags,
+			Flags:  config.PublishFlags,
 		},
 		{
-			Name:   "delete",
-			Usage:  "Delete a post",
+			Name:      "delete",
+			Usage:     "Delete a post, or many at once",
+			ArgsUsage: "<postId> [<token>]",
+			Description: `Deletes the post with the given ID, using its edit token if you give one or
+   it was published here.
+
+   To delete many posts at once, choose them with any of:
+
+   --all-anonymous   Every anonymous post published here, and not claimed
+   --blog <alias>    Every post on the given blog
+   -                 IDs read from stdin, separated by spaces or lines
+
+   Narrow them down with --before <date> and --match <regex>, which apply to
+   all of your posts if nothing else is chosen. The posts are listed, and you
+   are asked before they're deleted; use --dry-run to only list them, or --yes
+   to skip the question.`,
 			Action: requireAuth(commands.CmdDelete, "delete a post"),
 			Flags: []cli.Flag{
 				cli.BoolFlag{
@@ -90,6 +129,34 @@ func main() {
 					Usage: "Use a different port to connect to Tor",
 					Value: 9150,
 				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Save the delete to the outbox instead of sending it now",
+				},
+				cli.BoolFlag{
+					Name:  "all-anonymous",
+					Usage: "Delete every anonymous post published here that hasn't been claimed",
+				},
+				cli.StringFlag{
+					Name:  "blog, b",
+					Usage: "Delete every post on the given blog",
+				},
+				cli.StringFlag{
+					Name:  "before",
+					Usage: "Only delete posts created before the given date, e.g. 2006-01-02",
+				},
+				cli.StringFlag{
+					Name:  "match",
+					Usage: "Only delete posts whose title matches the given regular expression",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "List the posts that would be deleted without deleting them",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Delete many posts without asking first",
+				},
 				cli.BoolFlag{
 					Name:  "verbose, v",
 					Usage: "Make the operation more talkative",
@@ -97,8 +164,42 @@ func main() {
 			},
 		},
 		{
-			Name:   "update",
-			Usage:  "Update (overwrite) a post",
+			Name:  "gc",
+			Usage: "Delete posts that have expired",
+			Description: `Deletes each post published here with --expire whose time has passed, and
+   lists the posts it deleted.
+
+   Posts published by another account are skipped; log in as that account to
+   delete them. Use --dry-run to see what would be deleted first.`,
+			Action: requireAuth(commands.CmdGC, "delete expired posts"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "List expired posts without deleting them",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Delete via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:  "update",
+			Usage: "Update (overwrite) a post",
+			Description: `Replaces a post with what's read from stdin.
+
+   The post isn't updated if it was changed elsewhere since you last got,
+   published or updated it here. Use --diff to review the differences and
+   choose whether to overwrite them, or --force to update it without checking.`,
 			Action: requireAuth(commands.CmdUpdate, "update a post"),
 			Flags: []cli.Flag{
 				cli.BoolFlag{
@@ -110,14 +211,76 @@ func main() {
 					Usage: "Use a different port to connect to Tor",
 					Value: 9150,
 				},
-				cli.BoolFlag{
+				config.CodeFlag{
 					Name:  "code",
-					Usage: "Specifies this post is code",
+					Usage: "Specifies this post is code, optionally in the given language, e.g. --code=go",
 				},
 				cli.StringFlag{
 					Name:  "font",
 					Usage: "Sets post font to given value",
 				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Save the update to the outbox instead of sending it now",
+				},
+				cli.BoolFlag{
+					Name:  "diff",
+					Usage: "Show what will change and ask before updating",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Show what would change without updating",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Update without asking, even with --diff",
+				},
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Update even if the post was changed elsewhere since you got it",
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:      "edit",
+			Usage:     "Edit a post in your editor",
+			ArgsUsage: "<postId|slug>",
+			Description: `Opens an existing post in your editor, along with its font and language
+   between lines of "---". When you're done, the changes are shown and the
+   post is updated, unless nothing changed.
+
+   To edit a blog post by its slug, give the blog with -b.
+
+   If the post was changed elsewhere while you were editing it, you're shown
+   how your version differs and asked before it's overwritten. Use --force to
+   update it without checking.`,
+			Action: requireAuth(commands.CmdEdit, "edit a post"),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "c, b",
+					Usage: "Blog the post is on, to find it by slug",
+				},
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Update even if the post was changed elsewhere while you edited it",
+				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Save the update to the outbox instead of sending it now",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Edit via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
 				cli.BoolFlag{
 					Name:  "verbose, v",
 					Usage: "Make the operation more talkative",
@@ -125,10 +288,121 @@ func main() {
 			},
 		},
 		{
-			Name:   "get",
-			Usage:  "Read a raw post",
+			Name:      "drafts",
+			Usage:     "Manage posts you're still writing",
+			ArgsUsage: "list|edit|publish|rm [<id>...]",
+			Description: `Posts composed with 'wf new' are saved as drafts until they're
+   published. Each draft starts with its blog, font and language between
+   lines of "---", which you can change while editing.
+
+   drafts list             Show your drafts, most recently changed first
+   drafts edit <id>        Open a draft in your editor
+   drafts publish <id>...  Publish drafts, removing them once they're sent
+   drafts rm <id>...       Discard drafts without publishing them`,
+			Action: requireAuth(commands.CmdDrafts, "publish drafts"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "md",
+					Usage: "Returns post URL with Markdown enabled",
+				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Save published drafts to the outbox instead of sending them now",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Publish via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:      "outbox",
+			Usage:     "Manage posts, updates and deletes waiting to be sent",
+			ArgsUsage: "list|flush|drop [<id>...]",
+			Description: `When the server can't be reached, or the --offline flag is given, new posts,
+   updates and deletes are saved to the outbox instead of being lost.
+
+   outbox list          Show what's waiting to be sent
+   outbox flush         Send everything waiting in the outbox
+   outbox drop <id>...  Discard entries without sending them
+
+   Entries that can't reach the server, hit a server error or are rate
+   limited are retried with an increasing delay between attempts. Any other
+   failure marks the entry as failed, and it isn't retried. Use 'outbox flush --force' to try every entry immediately.`,
+			Action: requireAuth(commands.CmdOutbox, "send queued posts"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Retry entries now, even if they failed or are waiting to be retried later",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Send via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:      "get",
+			Usage:     "Read a raw post",
+			ArgsUsage: "<postId|blog/slug|URL>",
+			Description: `Outputs a post, given its ID, its blog and slug, or its URL, e.g.
+
+   wf get aaaaazzzzz
+   wf get notes/my-post
+   wf get https://example.com/notes/my-post
+
+   Posts on other instances are fetched from there, anonymously. So are posts
+   on blogs with their own domain, like https://blog.example.com/my-post.
+
+   Use --format to choose how the post is output:
+
+   raw   The post as it was written (default)
+   md    Markdown, with the post's blog, font and language as front matter
+   html  A web page, with the post rendered as it is on the web
+   json  The post's details from the API
+   txt   Plain text, with any Markdown removed
+
+   Posts published with --encrypt are decrypted with --decrypt. You're asked
+   for the passphrase, unless it's in the WRITEAS_PASSPHRASE environment
+   variable. For posts encrypted to your public key, give your OpenPGP secret
+   key or age identity file with --key.`,
 			Action: commands.CmdGet,
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "Output the post as raw, md, html, json or txt",
+					Value: "raw",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "Write the post to the given file instead of stdout",
+				},
+				cli.BoolFlag{
+					Name:  "decrypt",
+					Usage: "Decrypt an encrypted post",
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "Decrypt with the OpenPGP secret key or age identity in the given file",
+				},
 				cli.BoolFlag{
 					Name:  "tor, t",
 					Usage: "Get from Tor hidden service",
@@ -149,6 +423,10 @@ func main() {
 			Usage:  "List draft posts",
 			Action: requireAuth(commands.CmdListPosts, "view posts"),
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tag",
+					Usage: "List all of your posts with the given hashtag, on any blog",
+				},
 				cli.BoolFlag{
 					Name:  "id",
 					Usage: "Show list with post IDs (default)",
@@ -162,6 +440,223 @@ func main() {
 					Usage: "Show verbose post listing",
 				},
 			},
+		},
+		{
+			Name:  "browse",
+			Usage: "Browse your posts, drafts and blogs",
+			Description: `Lists your posts, drafts and blogs in the terminal, with a preview of the
+   selected one. Switch lists with Tab, move with the arrow keys, and press:
+
+     e, Enter  edit the post or draft in your editor
+     p         publish the draft, or move a post that isn't on a blog to one
+     m         move the post to another blog or your drafts, or change the
+               draft's blog
+     d         delete the post or draft
+     c         copy the post's or blog's URL
+     o         open the post or blog in your browser ($BROWSER, if set)
+     r         refresh
+     q         quit
+
+   With --script, keys are read from the given file ('-' for stdin) instead
+   of the terminal: key names like down, enter, esc and tab, or single
+   characters, separated by spaces or lines. The screen is written to
+   stdout at the end, and wherever the script says print. Posts are still
+   edited in your editor, but links aren't opened or copied.`,
+			Action: requireAuth(commands.CmdBrowse, "browse posts"),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "script",
+					Usage: "Press the keys in the given file instead of reading the terminal",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Browse posts via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+			},
+		},
+		{
+			Name:  "tags",
+			Usage: "List the hashtags in your posts",
+			Description: `Lists each hashtag used in your posts, with how many posts use it, most
+   used first. Hashtags are found the same way WriteFreely finds them to make
+   tag pages. See the posts with one with 'posts --tag <tag>'.`,
+			Action: requireAuth(commands.CmdTags, "view tags"),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "blog, b",
+					Usage: "Only count posts on the given blog",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Get posts via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:  "stats",
+			Usage: "Show how many times your posts have been viewed",
+			Description: `Lists your posts by how many times each has been viewed, then the views of
+   each blog, then the totals. Use --format csv or json to get the numbers
+   in a form other programs can read; csv has a row for each post, then
+   each blog, then the totals, with a type column telling them apart.
+
+   Use --snapshot to save the current view counts, e.g. from a daily cron
+   job. With --trend, each post's new views since the last snapshot are
+   shown too, and posts are listed by them.`,
+			Action: requireAuth(commands.CmdStats, "view stats"),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "blog, b",
+					Usage: "Only show posts on the given blog",
+				},
+				cli.IntFlag{
+					Name:  "top",
+					Usage: "Only list the given number of posts; blogs and totals still count them all",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Only show posts published since the given date, like 2006-01-02",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "Output the stats as text, csv or json",
+					Value: "text",
+				},
+				cli.BoolFlag{
+					Name:  "trend",
+					Usage: "Show the views since the last snapshot",
+				},
+				cli.BoolFlag{
+					Name:  "snapshot",
+					Usage: "Save the current view counts for --trend to compare with",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Get posts via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		},
+		{
+			Name:      "search",
+			Usage:     "Find posts by their title or text",
+			ArgsUsage: "<query>",
+			Description: `Lists the posts that have all of the words in the given query, ignoring
+   case, with a snippet of each around what matched. Put words in double
+   quotes to find them as a phrase, and use #tag or tag:<name> to find posts
+   with a hashtag. Use --regex to search with a regular expression instead.
+
+   Your posts on the server are searched if you're logged in, along with
+   pulled posts in your posts directory and your drafts. Pulled posts are
+   searched through an index kept up to date as you pull and push, and listed
+   most relevant first; use --offline to only search local files.`,
+			Action: requireAuth(commands.CmdSearch, "search posts"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "regex",
+					Usage: "Treat the query as a regular expression",
+				},
+				cli.StringFlag{
+					Name:  "blog, b",
+					Usage: "Only search posts on the given blog",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "Only search posts changed since the given date, e.g. 2006-01-02",
+				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Only search local files, not posts on the server",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Search via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		}, {
+			Name:  "pull",
+			Usage: "Save all of your posts as local files",
+			Description: `Saves each of your posts as a text file in your posts directory, with
+   posts on a blog in a folder named for it. The first time, you're asked
+   where the posts directory should be.
+
+   Edit the files, then send your changes with 'wf push'.`,
+			Action: requireAuth(commands.CmdPull, "pull"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Pull via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
+		}, {
+			Name:  "push",
+			Usage: "Update posts from local files you've changed",
+			Description: `Updates each post whose file in your posts directory was changed since it
+   was pulled.
+
+   Posts that were also changed elsewhere since they were pulled are skipped,
+   so nobody's changes are lost. Use 'wf get' to see the current version, or
+   --force to overwrite them.`,
+			Action: requireAuth(commands.CmdPush, "push"),
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Update posts even if they were changed elsewhere",
+				},
+				cli.BoolFlag{
+					Name:  "tor, t",
+					Usage: "Push via Tor hidden service",
+				},
+				cli.IntFlag{
+					Name:  "tor-port",
+					Usage: "Use a different port to connect to Tor",
+					Value: 9150,
+				},
+				cli.BoolFlag{
+					Name:  "verbose, v",
+					Usage: "Make the operation more talkative",
+				},
+			},
 		}, {
 			Name:   "blogs",
 			Usage:  "List blogs",
@@ -246,5 +741,5 @@ OPTIONS:
    {{range .Flags}}{{.}}
    {{end}}{{ end }}
 `
-	app.Run(os.Args)
+	return app
 }
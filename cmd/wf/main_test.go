@@ -0,0 +1,697 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/writeas/writeas-cli/commands"
+	"github.com/writeas/writeas-cli/internal/wftest"
+)
+
+// setUp starts a fake WriteFreely server with the given users, all with the
+// password "secret", and a home directory configured to trust the server.
+func setUp(t *testing.T, users ...string) (*wftest.Server, string) {
+	srv := wftest.NewServer(t)
+	for _, u := range users {
+		srv.AddUser(u, "secret")
+	}
+	home := wftest.Home(t)
+	ca := srv.WriteCACert(t, home)
+	wftest.WriteFile(t, home, filepath.Join(configDir, "config.ini"), "[api]\nca_cert = "+ca+"\n")
+	return srv, home
+}
+
+func logIn(t *testing.T, srv *wftest.Server, username string) wftest.Result {
+	t.Helper()
+	res := wftest.Run(t, newApp(), "secret\n", "--host", srv.Host(), "auth", username)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Couldn't log in as %s: %v\n%s", username, res.Err, res.Stderr)
+	}
+	return res
+}
+
+func TestAuthAndPost(t *testing.T) {
+	srv, _ := setUp(t, "alice")
+
+	res := wftest.Run(t, newApp(), "Hello", "--host", srv.Host(), "post")
+	if !strings.Contains(res.Stderr, "You must be authenticated to publish.") {
+		t.Errorf("Expected to be told to log in, got: %q", res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "wrong\n", "--host", srv.Host(), "auth", "alice")
+	if res.ExitCode == 0 {
+		t.Errorf("Log in with wrong password should fail")
+	}
+
+	res = logIn(t, srv, "alice")
+	if !strings.Contains(res.Stdout, "as default account") {
+		t.Errorf("First log in should set default account, got: %q", res.Stdout)
+	}
+
+	// With a default account, no --host or --user is needed
+	res = wftest.Run(t, newApp(), "# My first post\n\nHello, world.")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id := strings.TrimPrefix(strings.TrimSpace(res.Stdout), srv.URL+"/")
+	p, ok := srv.Post(id)
+	if !ok {
+		t.Fatalf("Post %q wasn't created; output: %q", id, res.Stdout)
+	}
+	if p.Title != "My first post" || p.Content != "Hello, world." {
+		t.Errorf("Post has title %q and content %q", p.Title, p.Content)
+	}
+	if owner := srv.Owner(id); owner != "alice" {
+		t.Errorf("Post should belong to alice, but owner is %q", owner)
+	}
+
+	res = wftest.Run(t, newApp(), "", "get", id)
+	if res.Stdout != "# My first post\n\nHello, world.\n" {
+		t.Errorf("Unexpected get output: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "# My first post\n\nUpdated.", "update", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Update failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Updated." {
+		t.Errorf("Post wasn't updated, content is %q", p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "", "delete", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Delete failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if _, ok := srv.Post(id); ok {
+		t.Errorf("Post wasn't deleted")
+	}
+
+	res = wftest.Run(t, newApp(), "", "logout")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Log out failed: %v\n%s", res.Err, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "Hello", "--host", srv.Host(), "post")
+	if !strings.Contains(res.Stderr, "You must be authenticated") {
+		t.Errorf("Expected to be logged out, got: %q", res.Stderr)
+	}
+}
+
+func TestMultipleAccounts(t *testing.T) {
+	srv, _ := setUp(t, "alice", "bob")
+	logIn(t, srv, "alice")
+	logIn(t, srv, "bob")
+
+	res := wftest.Run(t, newApp(), "", "accounts")
+	if !strings.Contains(res.Stdout, "alice (default)") || !strings.Contains(res.Stdout, "bob") {
+		t.Errorf("Unexpected accounts output: %q", res.Stdout)
+	}
+
+	// A host with several accounts needs a user
+	res = wftest.Run(t, newApp(), "Hello", "--host", srv.Host(), "post")
+	if res.ExitCode != commands.ExitUsage || !strings.Contains(res.Stderr, "Multiple logged in users") {
+		t.Errorf("Expected multiple users error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "Hello from Bob", "--host", srv.Host(), "--user", "bob", "post")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id := strings.TrimPrefix(strings.TrimSpace(res.Stdout), srv.URL+"/")
+	if owner := srv.Owner(id); owner != "bob" {
+		t.Errorf("Post should belong to bob, but owner is %q", owner)
+	}
+
+	// Once only one account is left on the host, it's used automatically
+	res = wftest.Run(t, newApp(), "", "--host", srv.Host(), "--user", "alice", "logout")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Log out failed: %v\n%s", res.Err, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "Hello again", "--host", srv.Host(), "post")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id = strings.TrimPrefix(strings.TrimSpace(res.Stdout), srv.URL+"/")
+	if owner := srv.Owner(id); owner != "bob" {
+		t.Errorf("Post should belong to bob, but owner is %q", owner)
+	}
+}
+
+func TestBlogs(t *testing.T) {
+	srv, _ := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	logIn(t, srv, "alice")
+
+	res := wftest.Run(t, newApp(), "", "blogs")
+	if !strings.Contains(res.Stdout, "notes   Alice's Notes") {
+		t.Errorf("Unexpected blogs output: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "# On a blog\n\nHi.", "post", "-b", "notes")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if strings.TrimSpace(res.Stdout) != srv.URL+"/notes/on-a-blog" {
+		t.Errorf("Unexpected post URL: %q", res.Stdout)
+	}
+}
+
+func TestGet(t *testing.T) {
+	srv, _ := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	p := srv.AddPost("alice", "notes", "Blog post", "On a blog.")
+	logIn(t, srv, "alice")
+	// Another instance; test servers share a certificate, so it's trusted too
+	other := wftest.NewServer(t)
+	other.AddCollection("bob", "journal", "Bob's Journal")
+	otherPost := other.AddPost("bob", "journal", "Elsewhere", "On another instance.")
+	// Blogs on their own domains
+	domain := wftest.NewBlogDomain(t, srv, "notes")
+	otherDomain := wftest.NewBlogDomain(t, other, "journal")
+
+	tt := map[string]string{
+		p.ID:                              "On a blog.",
+		"notes/blog-post":                 "On a blog.",
+		srv.URL + "/notes/blog-post":      "On a blog.",
+		srv.URL + "/" + p.ID + ".md":      "On a blog.",
+		other.URL + "/journal/elsewhere":  "On another instance.",
+		other.Host() + "/" + otherPost.ID: "On another instance.",
+		domain.URL + "/blog-post":         "On a blog.",
+		otherDomain.URL + "/elsewhere.md": "On another instance.",
+	}
+	for ref, content := range tt {
+		res := wftest.Run(t, newApp(), "", "get", ref)
+		if res.ExitCode != 0 || !strings.Contains(res.Stdout, content) {
+			t.Errorf("get %s: expected %q, got %d: %q\n%s", ref, content, res.ExitCode, res.Stdout, res.Stderr)
+		}
+	}
+
+	res := wftest.Run(t, newApp(), "", "get", srv.URL+"/a/b/c")
+	if res.ExitCode != commands.ExitUsage {
+		t.Errorf("Expected usage error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "get", domain.URL+"/missing")
+	if res.ExitCode != commands.ExitNotFound {
+		t.Errorf("Expected not found on blog domain, got %d: %q", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestGetFormats(t *testing.T) {
+	srv, home := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	p := srv.AddPost("alice", "notes", "Formatted", "Some *emphasis* and a [link](https://example.com).")
+	logIn(t, srv, "alice")
+
+	tt := map[string]string{
+		"raw":  "# Formatted\n\nSome *emphasis* and a [link](https://example.com).\n",
+		"md":   "---\nblog: notes\nfont: norm\nlang:\n---\n# Formatted\n\nSome *emphasis* and a [link](https://example.com).\n",
+		"txt":  "Formatted\n\nSome emphasis and a link.\n",
+		"html": "<h1>Formatted</h1>\n<p>Some <em>emphasis</em> and a <a href=\"https://example.com\" rel=\"nofollow\">link</a>.</p>",
+		"json": `"slug": "formatted"`,
+	}
+	for format, expected := range tt {
+		res := wftest.Run(t, newApp(), "", "get", "--format", format, "notes/formatted")
+		if res.ExitCode != 0 || !strings.Contains(res.Stdout, expected) {
+			t.Errorf("%s: expected %q, got %d: %q\n%s", format, expected, res.ExitCode, res.Stdout, res.Stderr)
+		}
+	}
+
+	fname := filepath.Join(home, "post.html")
+	res := wftest.Run(t, newApp(), "", "get", "--format", "html", "-o", fname, p.ID)
+	if res.ExitCode != 0 || res.Stdout != "" {
+		t.Fatalf("get -o failed, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if b, err := ioutil.ReadFile(fname); err != nil || !strings.Contains(string(b), "<title>Formatted</title>") {
+		t.Errorf("Post wasn't saved as HTML: %v %q", err, b)
+	}
+
+	res = wftest.Run(t, newApp(), "", "get", "--format", "pdf", p.ID)
+	if res.ExitCode != commands.ExitUsage || !strings.Contains(res.Stderr, "Unknown format") {
+		t.Errorf("Expected unknown format error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestPull(t *testing.T) {
+	srv, home := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	draft := srv.AddPost("alice", "", "A draft", "Not on a blog.")
+	srv.AddPost("alice", "notes", "Blog post", "On a blog.")
+	srv.AddPost("", "", "", "Someone else's post.")
+	logIn(t, srv, "alice")
+
+	// The first pull asks where to keep posts
+	postsDir := filepath.Join(home, "posts")
+	res := wftest.Run(t, newApp(), postsDir+"\n", "pull")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Pull failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if !strings.Contains(res.Stdout, "Created posts directory.") {
+		t.Errorf("Expected posts directory to be created, got: %q", res.Stdout)
+	}
+
+	files := map[string]string{
+		draft.ID + ".txt":     "# A draft\n\nNot on a blog.",
+		"notes/blog-post.txt": "# Blog post\n\nOn a blog.",
+	}
+	for name, content := range files {
+		b, err := ioutil.ReadFile(filepath.Join(postsDir, name))
+		if err != nil {
+			t.Errorf("Post wasn't pulled: %v", err)
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("%s has content %q, expected %q", name, b, content)
+		}
+	}
+	all, _ := filepath.Glob(filepath.Join(postsDir, "*.txt"))
+	if len(all) != 1 {
+		t.Errorf("Expected only alice's draft in posts directory, found %v", all)
+	}
+}
+
+func TestPush(t *testing.T) {
+	srv, home := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	draft := srv.AddPost("alice", "", "A draft", "Not on a blog.")
+	blogPost := srv.AddPost("alice", "notes", "Blog post", "On a blog.")
+	logIn(t, srv, "alice")
+	postsDir := filepath.Join(home, "posts")
+	if res := wftest.Run(t, newApp(), postsDir+"\n", "pull"); res.ExitCode != 0 {
+		t.Fatalf("Pull failed: %v\n%s", res.Err, res.Stderr)
+	}
+
+	res := wftest.Run(t, newApp(), "", "push", "-v")
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "Nothing to push.") {
+		t.Errorf("Expected nothing to push, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	// Both posts are changed locally, but the blog post was also changed on
+	// the server since it was pulled
+	wftest.WriteFile(t, postsDir, draft.ID+".txt", "# A draft\n\nStill not on a blog.")
+	wftest.WriteFile(t, postsDir, "notes/blog-post.txt", "# Blog post\n\nMy changes.")
+	srv.EditPost(blogPost.ID, "Blog post", "Their changes.")
+	res = wftest.Run(t, newApp(), "", "push")
+	if res.ExitCode != commands.ExitConflict || !strings.Contains(res.Stderr, "by alice") {
+		t.Errorf("Expected conflict, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	if p, _ := srv.Post(draft.ID); p.Content != "Still not on a blog." {
+		t.Errorf("Draft wasn't pushed, content is %q", p.Content)
+	}
+	if p, _ := srv.Post(blogPost.ID); p.Content != "Their changes." {
+		t.Errorf("Conflicting push overwrote post, content is %q", p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "", "push", "--force")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Forced push failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(blogPost.ID); p.Content != "My changes." {
+		t.Errorf("Blog post wasn't pushed, content is %q", p.Content)
+	}
+	res = wftest.Run(t, newApp(), "", "push", "-v")
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "Nothing to push.") {
+		t.Errorf("Expected nothing left to push, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	// Fetching the post after it changed on the server doesn't hide the
+	// conflict with the pulled file
+	srv.EditPost(blogPost.ID, "Blog post", "Their second changes.")
+	wftest.Run(t, newApp(), "", "get", blogPost.ID)
+	wftest.WriteFile(t, postsDir, "notes/blog-post.txt", "# Blog post\n\nMy second changes.")
+	res = wftest.Run(t, newApp(), "", "push")
+	if res.ExitCode != commands.ExitConflict {
+		t.Errorf("Expected conflict after get, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	if p, _ := srv.Post(blogPost.ID); p.Content != "Their second changes." {
+		t.Errorf("Push after get overwrote post, content is %q", p.Content)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	srv, _ := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	p := srv.AddPost("alice", "notes", "Blog post", "Frist draft.")
+	logIn(t, srv, "alice")
+
+	wftest.Editor(t, `true`)
+	res := wftest.Run(t, newApp(), "", "edit", "-b", "notes", p.Slug)
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "No changes.") {
+		t.Fatalf("Expected no changes, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	wftest.Editor(t, `sed 's/Frist/First/; s/^font:.*/font: sans/' "$1" > "$1.new" && mv "$1.new" "$1"`)
+	res = wftest.Run(t, newApp(), "", "edit", "-b", "notes", p.Slug)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Edit failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if !strings.Contains(res.Stdout, "-Frist draft.\n+First draft.\n") {
+		t.Errorf("Diff wasn't shown: %q", res.Stdout)
+	}
+	edited, _ := srv.Post(p.ID)
+	if edited.Title != "Blog post" || edited.Content != "First draft.\n" || edited.Font != "sans" {
+		t.Errorf("Post wasn't updated: %+v", edited)
+	}
+
+	// An update saved to the outbox isn't sent if the post is changed on the
+	// server before the outbox is flushed
+	wftest.Editor(t, `sed 's/First/Final/' "$1" > "$1.new" && mv "$1.new" "$1"`)
+	res = wftest.Run(t, newApp(), "", "edit", "--offline", "-b", "notes", p.Slug)
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "Saved update to outbox") {
+		t.Fatalf("Expected update to be saved to outbox, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	srv.EditPost(p.ID, "Blog post", "Their changes.")
+	res = wftest.Run(t, newApp(), "", "outbox", "flush")
+	if res.ExitCode != commands.ExitConflict || !strings.Contains(res.Stderr, "by alice") {
+		t.Errorf("Expected conflict, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	if edited, _ := srv.Post(p.ID); edited.Content != "Their changes." {
+		t.Errorf("Queued update overwrote post, content is %q", edited.Content)
+	}
+	res = wftest.Run(t, newApp(), "", "outbox", "list")
+	if !strings.Contains(res.Stdout, "failed") || !strings.Contains(res.Stdout, "update "+p.ID) {
+		t.Errorf("Conflicting update should be kept in outbox as failed, got: %q", res.Stdout)
+	}
+
+	// Failed entries aren't retried until forced
+	res = wftest.Run(t, newApp(), "", "outbox", "flush")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Errorf("Expected failed update to be skipped, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "outbox", "flush", "--force")
+	if res.ExitCode != commands.ExitConflict {
+		t.Errorf("Expected forced flush to retry update, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	if edited, _ := srv.Post(p.ID); edited.Content != "Their changes." {
+		t.Errorf("Queued update overwrote post, content is %q", edited.Content)
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	srv, home := setUp(t, "alice", "bob")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	meeting := srv.AddPost("alice", "notes", "Meeting notes", "We met.")
+	trip := srv.AddPost("alice", "notes", "Trip report", "We went.")
+	draft := srv.AddPost("alice", "", "", "Just an idea.")
+	other := srv.AddPost("bob", "", "", "Bob's post.")
+	logIn(t, srv, "alice")
+	postsDir := filepath.Join(home, "posts")
+	if res := wftest.Run(t, newApp(), postsDir+"\n", "pull"); res.ExitCode != 0 {
+		t.Fatalf("Pull failed: %v\n%s", res.Err, res.Stderr)
+	}
+
+	res := wftest.Run(t, newApp(), "", "delete", "--blog", "notes", "--match", "^Meeting", "--dry-run")
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, meeting.ID) || strings.Contains(res.Stdout, trip.ID) {
+		t.Errorf("Unexpected dry run, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if _, ok := srv.Post(meeting.ID); !ok {
+		t.Fatalf("Dry run deleted post")
+	}
+
+	res = wftest.Run(t, newApp(), "", "delete", "--blog", "notes", "--match", "^Meeting", "--yes")
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, "Post "+meeting.ID+"...OK") {
+		t.Fatalf("Delete failed, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if _, ok := srv.Post(meeting.ID); ok {
+		t.Errorf("Matching post wasn't deleted")
+	}
+	if _, ok := srv.Post(trip.ID); !ok {
+		t.Errorf("Post that doesn't match was deleted")
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(postsDir, "notes", "meeting-notes.txt")); err == nil {
+		t.Errorf("Pulled file of deleted post wasn't removed")
+	}
+
+	res = wftest.Run(t, newApp(), "", "delete", "--before", "2000-01-01", "--yes")
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "No posts to delete.") {
+		t.Errorf("Expected no posts before 2000, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "delete", "--before", "last week")
+	if res.ExitCode != commands.ExitUsage {
+		t.Errorf("Expected usage error for bad date, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	// IDs from stdin; bob's post can't be deleted, but the others still are
+	res = wftest.Run(t, newApp(), trip.ID+"\n"+other.ID+"\n"+draft.ID+"\n", "delete", "-", "--yes")
+	if res.ExitCode != commands.ExitBadToken || !strings.Contains(res.Stderr, "2 deleted, 1 failed") {
+		t.Errorf("Expected one failure, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	for _, id := range []string{trip.ID, draft.ID} {
+		if _, ok := srv.Post(id); ok {
+			t.Errorf("Post %s wasn't deleted", id)
+		}
+	}
+	if _, ok := srv.Post(other.ID); !ok {
+		t.Errorf("Someone else's post was deleted")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv, home := setUp(t, "alice", "bob")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	meeting := srv.AddPost("alice", "notes", "Meeting notes", "We went over the budget for the launch.")
+	srv.AddPost("alice", "", "Groceries", "Apples and pears.")
+	srv.AddPost("bob", "", "Bob's budget", "Not alice's.")
+	logIn(t, srv, "alice")
+	postsDir := filepath.Join(home, "posts")
+	if res := wftest.Run(t, newApp(), postsDir+"\n", "pull"); res.ExitCode != 0 {
+		t.Fatalf("Pull failed: %v\n%s", res.Err, res.Stderr)
+	}
+	wftest.WriteFile(t, postsDir, "notes/old-budget.txt", "# Old budget\n\nLast year's numbers.")
+	wftest.Editor(t, `printf 'Budget ideas for next year.\n' >> "$1"; exit 1`)
+	wftest.Run(t, newApp(), "", "new")
+
+	res := wftest.Run(t, newApp(), "", "search", "BUDGET")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Search failed: %v\n%s", res.Err, res.Stderr)
+	}
+	expected := []string{
+		meeting.ID + "  " + srv.URL + "/notes/meeting-notes\nMeeting notes\n    We went over the budget for the launch.\n",
+		"-  " + filepath.Join(postsDir, "notes", "old-budget.txt") + "\nOld budget\n",
+		"Budget ideas for next year.\n    Budget ideas for next year.\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(res.Stdout, e) {
+			t.Errorf("Expected %q in results, got:\n%s", e, res.Stdout)
+		}
+	}
+	if strings.Contains(res.Stdout, "Bob") || strings.Count(res.Stdout, "Meeting notes") != 1 {
+		t.Errorf("Unexpected results:\n%s", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "search", "--regex", "--blog", "notes", "^(Apples|Last)")
+	if !strings.Contains(res.Stdout, "Old budget") || strings.Contains(res.Stdout, "Groceries") {
+		t.Errorf("Expected only the pulled blog post, got:\n%s", res.Stdout)
+	}
+	// Offline, pulled posts are found through the index
+	res = wftest.Run(t, newApp(), "", "search", "--offline", `"the budget"`)
+	if !strings.HasPrefix(res.Stdout, meeting.ID+"  "+srv.URL+"/"+meeting.ID+"\nMeeting notes\n") || strings.Contains(res.Stdout, "ideas") {
+		t.Errorf("Expected only the pulled meeting notes, got:\n%s", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "search", "--since", "2999-01-01", "budget")
+	if res.Stdout != "" || !strings.Contains(res.Stderr, "No posts found.") {
+		t.Errorf("Expected nothing since 2999, got %q %q", res.Stdout, res.Stderr)
+	}
+}
+
+func TestTags(t *testing.T) {
+	srv, home := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	meeting := srv.AddPost("alice", "notes", "Meeting notes", "Planning the launch. #work #Planning")
+	srv.AddPost("alice", "notes", "Recipe", "Not a#tag, and #123 isn't either.")
+	standup := srv.AddPost("alice", "", "", "Standup went long. #work")
+	logIn(t, srv, "alice")
+
+	res := wftest.Run(t, newApp(), "", "tags")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Tags failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if lines := strings.Split(strings.TrimSpace(res.Stdout), "\n"); len(lines) != 2 ||
+		strings.Join(strings.Fields(lines[0]), " ") != "work 2" || strings.Join(strings.Fields(lines[1]), " ") != "planning 1" {
+		t.Errorf("Unexpected tags:\n%s", res.Stdout)
+	}
+	res = wftest.Run(t, newApp(), "", "tags", "--blog", "notes")
+	if strings.Join(strings.Fields(res.Stdout), " ") != "planning 1 work 1" {
+		t.Errorf("Unexpected tags on blog:\n%s", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "posts", "--tag", "#Work")
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, meeting.ID) || !strings.Contains(res.Stdout, standup.ID) || strings.Count(res.Stdout, "\n") != 2 {
+		t.Errorf("Expected both work posts, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	// Tags in front matter are added as hashtags
+	file := wftest.WriteFile(t, home, "trip.md", "---\nblog: notes\ntags: travel, work\n---\nOff to the beach. #travel\n")
+	res = wftest.Run(t, newApp(), "", "publish", file)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Publish failed: %v\n%s", res.Err, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "posts", "--tag", "travel")
+	id := strings.TrimSpace(res.Stdout)
+	p, ok := srv.Post(id)
+	if !ok {
+		t.Fatalf("Published post %q not found by tag", id)
+	}
+	if strings.Contains(p.Content, "---") || !strings.HasSuffix(strings.TrimSpace(p.Content), "Off to the beach. #travel\n\n#work") {
+		t.Errorf("Unexpected content: %q", p.Content)
+	}
+	if p.Collection == nil || p.Collection.Alias != "notes" {
+		t.Errorf("Post wasn't published on the blog from its front matter")
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv, _ := setUp(t, "alice", "bob")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	meeting := srv.AddPost("alice", "notes", "Meeting notes", "We met.")
+	trip := srv.AddPost("alice", "notes", "Trip report", "We went.")
+	draft := srv.AddPost("alice", "", "", "Just an idea.")
+	other := srv.AddPost("bob", "", "", "Bob's post.")
+	srv.SetViews(meeting.ID, 5)
+	srv.SetViews(trip.ID, 40)
+	srv.SetViews(draft.ID, 2)
+	srv.SetViews(other.ID, 1000)
+	logIn(t, srv, "alice")
+
+	res := wftest.Run(t, newApp(), "", "stats", "--snapshot")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Stats failed: %v\n%s", res.Err, res.Stderr)
+	}
+	lines := strings.Split(res.Stdout, "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[1], "40 ") || !strings.Contains(lines[1], trip.ID) || !strings.Contains(lines[3], draft.ID) {
+		t.Errorf("Posts aren't listed by views:\n%s", res.Stdout)
+	}
+	if !strings.Contains(res.Stdout, "\n45     2      notes\n") || !strings.HasSuffix(res.Stdout, "\n47 views on 3 posts\n") || strings.Contains(res.Stdout, other.ID) {
+		t.Errorf("Unexpected totals:\n%s", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "stats", "--blog", "notes", "--top", "1", "--format", "csv")
+	if res.Stdout != "type,id,title,blog,created,posts,views\n"+
+		"post,"+trip.ID+",Trip report,notes,"+trip.Created.Format(time.RFC3339)+",,40\n"+
+		"blog,,,notes,,2,45\n"+
+		"total,,,,,2,45\n" {
+		t.Errorf("Unexpected CSV: %q", res.Stdout)
+	}
+
+	srv.SetViews(meeting.ID, 25)
+	res = wftest.Run(t, newApp(), "", "stats", "--trend", "--format", "json")
+	var st struct {
+		Posts []struct {
+			ID     string
+			Views  int64
+			Change *int64
+		}
+		TotalViews int64 `json:"total_views"`
+		Change     int64
+		Since      *time.Time
+	}
+	if err := json.Unmarshal([]byte(res.Stdout), &st); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, res.Stdout)
+	}
+	if st.Since == nil || st.Change != 20 || st.TotalViews != 67 || len(st.Posts) != 3 || st.Posts[0].ID != meeting.ID || st.Posts[0].Change == nil || *st.Posts[0].Change != 20 {
+		t.Errorf("Unexpected trend: %+v", st)
+	}
+	for _, p := range st.Posts[1:] {
+		if p.Change == nil || *p.Change != 0 {
+			t.Errorf("Expected a change of 0 for %s, got %v", p.ID, p.Change)
+		}
+	}
+
+	res = wftest.Run(t, newApp(), "", "stats", "--format", "xml")
+	if res.ExitCode != commands.ExitUsage {
+		t.Errorf("Expected usage error for unknown format, got %d", res.ExitCode)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	srv, home := setUp(t, "alice")
+	srv.AddCollection("alice", "notes", "Alice's Notes")
+	meeting := srv.AddPost("alice", "notes", "Meeting notes", "We went over the budget for the launch.")
+	idea := srv.AddPost("alice", "", "", "Just an idea.")
+	logIn(t, srv, "alice")
+	wftest.Editor(t, `printf 'Budget ideas for next year.\n' >> "$1"; exit 1`)
+	wftest.Run(t, newApp(), "", "new")
+
+	// Newest first, with a preview of the selected post
+	res := wftest.Run(t, newApp(), "down", "browse", "--script", "-")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Browse failed: %v\n%s", res.Err, res.Stderr)
+	}
+	lines := strings.Split(res.Stdout, "\n")
+	if !strings.HasPrefix(lines[0], "[Posts (2)]  Drafts (1)   Blogs (1)") || !strings.HasPrefix(lines[2], "  "+idea.ID) || !strings.HasPrefix(lines[3], "> "+meeting.ID) {
+		t.Errorf("Unexpected list:\n%s", res.Stdout)
+	}
+	if !strings.Contains(res.Stdout, "\nMeeting notes\nOn notes, published ") || !strings.Contains(res.Stdout, "\nWe went over the budget for the launch.\n") {
+		t.Errorf("Unexpected preview:\n%s", res.Stdout)
+	}
+
+	// Publish the post that isn't on a blog to the only one
+	wftest.Run(t, newApp(), "p enter", "browse", "--script", "-")
+	if p, _ := srv.Post(idea.ID); p.Collection == nil || p.Collection.Alias != "notes" {
+		t.Errorf("Post wasn't moved to the blog")
+	}
+
+	// Publish the local draft on the blog
+	res = wftest.Run(t, newApp(), "tab p up enter print tab", "browse", "--script", "-")
+	if !strings.Contains(res.Stdout, "Published "+srv.URL+"/notes/") || !strings.Contains(res.Stdout, "[Blogs (1)]") || !strings.Contains(res.Stdout, "notes  Alice's Notes  3 posts") {
+		t.Errorf("Draft wasn't published:\n%s", res.Stdout)
+	}
+	if res = wftest.Run(t, newApp(), "", "drafts", "list"); res.Stdout != "" {
+		t.Errorf("Published draft wasn't removed: %q", res.Stdout)
+	}
+
+	// Move a post back to drafts
+	res = wftest.Run(t, newApp(), "G m print enter", "browse", "--script", "-")
+	if !strings.Contains(res.Stdout, "Move "+meeting.ID+" to:\n> -  No blog\n") || !strings.Contains(res.Stdout, "Moved "+meeting.ID+" to your drafts.") {
+		t.Errorf("Unexpected move:\n%s", res.Stdout)
+	}
+	if p, _ := srv.Post(meeting.ID); p.Collection != nil {
+		t.Errorf("Post wasn't moved to drafts")
+	}
+
+	// Delete only once confirmed
+	res = wftest.Run(t, newApp(), "3 enter d n print d y", "browse", "--script", "-")
+	screens := strings.Split(res.Stdout, "\n\n[")
+	if len(screens) != 2 || !strings.Contains(screens[0], "[Posts on notes (2)]") || !strings.Contains(screens[0], "Cancelled.") {
+		t.Errorf("Unexpected cancelled delete:\n%s", res.Stdout)
+	}
+	if !strings.Contains(res.Stdout, "[Posts on notes (1)]") || !strings.Contains(res.Stdout, "Deleted ") {
+		t.Errorf("Unexpected delete:\n%s", res.Stdout)
+	}
+	if _, ok := srv.Post(idea.ID); !ok {
+		t.Errorf("Older post was deleted instead of the newest")
+	}
+
+	// Links aren't opened or copied by scripts
+	opened := filepath.Join(home, "opened")
+	browser := wftest.WriteFile(t, home, "browser", "#!/bin/sh\necho \"$1\" > "+opened+"\n")
+	os.Chmod(browser, 0700)
+	t.Setenv("BROWSER", browser)
+	res = wftest.Run(t, newApp(), "3 o print c", "browse", "--script", "-")
+	if !strings.Contains(res.Stdout, "\nOpened "+srv.URL+"/notes/\n") || !strings.Contains(res.Stdout, "\nCopied "+srv.URL+"/notes/\n") {
+		t.Errorf("Unexpected status:\n%s", res.Stdout)
+	}
+	if _, err := os.Stat(opened); err == nil {
+		t.Errorf("Browser was started by a script")
+	}
+
+	// Change the blog of a draft
+	wftest.Run(t, newApp(), "", "new")
+	res = wftest.Run(t, newApp(), "tab m print up enter", "browse", "--script", "-")
+	if !strings.Contains(res.Stdout, "\nChange blog of draft ") || !strings.Contains(res.Stdout, " will be published on notes.") {
+		t.Errorf("Unexpected draft move:\n%s", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "down sideways", "browse", "--script", "-")
+	if res.ExitCode != commands.ExitUsage || !strings.Contains(res.Stderr, `unknown key "sideways"`) {
+		t.Errorf("Expected usage error for unknown key, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "browse")
+	if res.ExitCode != commands.ExitUsage || !strings.Contains(res.Stderr, "--script") {
+		t.Errorf("Expected to be told to use --script without a terminal, got %d: %q", res.ExitCode, res.Stderr)
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/writeas/writeas-cli/commands"
+	"github.com/writeas/writeas-cli/internal/wftest"
+)
+
+// setUp starts a fake server with the account "matt" and a home directory
+// configured to use it instead of Write.as.
+func setUp(t *testing.T) *wftest.Server {
+	srv := wftest.NewServer(t)
+	srv.AddUser("matt", "secret")
+	home := wftest.Home(t)
+	ca := srv.WriteCACert(t, home)
+	wftest.WriteFile(t, home, filepath.Join(configDir, "config.ini"), `[default]
+host = `+srv.URL+`
+user = user
+
+[api]
+ca_cert = `+ca+"\n")
+	return srv
+}
+
+// logIn authenticates as matt, so posts can be published.
+func logIn(t *testing.T) {
+	t.Helper()
+	res := wftest.Run(t, newApp(), "", "auth", "-p", "secret", "matt")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Log in failed: %v\n%s", res.Err, res.Stderr)
+	}
+}
+
+// addAnonymous creates an anonymous post on the server, and stores it locally
+// with its edit token, as if it had been published from here.
+func addAnonymous(t *testing.T, srv *wftest.Server, body string) string {
+	t.Helper()
+	p := srv.AddPost("", "", "", body)
+	res := wftest.Run(t, newApp(), "", "add", p.ID, p.Token)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Add failed: %v\n%s", res.Err, res.Stderr)
+	}
+	return p.ID
+}
+
+func postID(srv *wftest.Server, res wftest.Result) string {
+	return strings.TrimPrefix(strings.TrimSpace(res.Stdout), srv.URL+"/")
+}
+
+func TestAnonymousPosts(t *testing.T) {
+	srv := setUp(t)
+
+	// New posts need an account
+	for _, args := range [][]string{{"post"}, {"post", "--offline"}} {
+		res := wftest.Run(t, newApp(), "Anonymous thoughts.", args...)
+		if res.ExitCode != commands.ExitNotLoggedIn || !strings.Contains(res.Stderr, "Not currently logged in") {
+			t.Errorf("%v: expected to be told to log in, got %d: %q", args, res.ExitCode, res.Stderr)
+		}
+	}
+
+	// Posts published anonymously are kept track of with their edit tokens
+	id := addAnonymous(t, srv, "Anonymous thoughts.")
+	res := wftest.Run(t, newApp(), "", "posts")
+	if strings.TrimSpace(res.Stdout) != id {
+		t.Errorf("Post wasn't saved locally, posts output: %q", res.Stdout)
+	}
+
+	// The edit token saved locally is used to update and delete
+	res = wftest.Run(t, newApp(), "Second thoughts.", "update", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Update failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Second thoughts." {
+		t.Errorf("Post wasn't updated, content is %q", p.Content)
+	}
+
+	// Editing finds the edit token the same way
+	wftest.Editor(t, `printf 'Third thoughts.\n' >> "$1"`)
+	res = wftest.Run(t, newApp(), "", "edit", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Edit failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Second thoughts.\nThird thoughts.\n" {
+		t.Errorf("Post wasn't edited, content is %q", p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "Fourth thoughts.", "update", "--dry-run", id)
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, "-Third thoughts.\n+Fourth thoughts.\n") {
+		t.Errorf("Diff wasn't shown, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Second thoughts.\nThird thoughts.\n" {
+		t.Errorf("Dry run changed post, content is %q", p.Content)
+	}
+	res = wftest.Run(t, newApp(), "Fourth thoughts.", "update", "--diff", "--yes", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Update failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Fourth thoughts." {
+		t.Errorf("Post wasn't updated, content is %q", p.Content)
+	}
+	res = wftest.Run(t, newApp(), "Fourth thoughts.", "update", "--diff", id)
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "No changes.") {
+		t.Errorf("Expected no changes, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	// Someone else changes the post in the meantime
+	srv.EditPost(id, "", "Their thoughts.")
+	res = wftest.Run(t, newApp(), "Fifth thoughts.", "update", id)
+	if res.ExitCode != commands.ExitConflict || !strings.Contains(res.Stderr, "was changed") {
+		t.Errorf("Expected conflict, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Their thoughts." {
+		t.Errorf("Conflicting update overwrote post, content is %q", p.Content)
+	}
+	res = wftest.Run(t, newApp(), "Fifth thoughts.", "update", "--force", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Forced update failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if p, _ := srv.Post(id); p.Content != "Fifth thoughts." {
+		t.Errorf("Post wasn't updated, content is %q", p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "", "update", id, "badtoken")
+	if res.ExitCode != commands.ExitBadToken || !strings.Contains(res.Stderr, "bad edit token") {
+		t.Errorf("Expected bad token error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "", "delete", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Delete failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if _, ok := srv.Post(id); ok {
+		t.Errorf("Post wasn't deleted")
+	}
+
+	res = wftest.Run(t, newApp(), "", "get", id)
+	if res.ExitCode != commands.ExitNotFound {
+		t.Errorf("Expected not found error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	logIn(t)
+	res = wftest.Run(t, newApp(), "")
+	if res.ExitCode != commands.ExitInvalid {
+		t.Errorf("Expected empty post error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	srv := setUp(t)
+
+	var ids []string
+	for _, body := range []string{"First.", "Second."} {
+		ids = append(ids, addAnonymous(t, srv, body))
+	}
+	// A post with a token that's no longer valid can't be claimed
+	stale := srv.AddPost("", "", "", "Stale.")
+	res := wftest.Run(t, newApp(), "", "add", stale.ID, "wrongtoken")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Add failed: %v\n%s", res.Err, res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "", "claim")
+	if !strings.Contains(res.Stderr, "must be authenticated") {
+		t.Errorf("Expected to be told to log in, got: %q", res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "", "auth", "-p", "secret", "matt")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Log in failed: %v\n%s", res.Err, res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "", "claim", "-v")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Claim failed: %v\n%s", res.Err, res.Stderr)
+	}
+	for _, id := range ids {
+		if owner := srv.Owner(id); owner != "matt" {
+			t.Errorf("Post %s should belong to matt, but owner is %q", id, owner)
+		}
+	}
+	if owner := srv.Owner(stale.ID); owner != "" {
+		t.Errorf("Post with bad token was claimed by %q", owner)
+	}
+
+	// Only successfully claimed posts are removed from the local list
+	res = wftest.Run(t, newApp(), "", "posts")
+	expected := "Anonymous Posts\n" + ids[1] + "\n" + ids[0] + "\n\nUnclaimed Posts\n" + stale.ID + "\n"
+	if res.Stdout != expected {
+		t.Errorf("Expected claimed posts listed from account, got: %q", res.Stdout)
+	}
+
+	// New posts now belong to the account
+	res = wftest.Run(t, newApp(), "Signed thoughts.")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if owner := srv.Owner(postID(srv, res)); owner != "matt" {
+		t.Errorf("Post should belong to matt, but owner is %q", owner)
+	}
+
+	res = wftest.Run(t, newApp(), "", "logout")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Log out failed: %v\n%s", res.Err, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "claim")
+	if !strings.Contains(res.Stderr, "must be authenticated") {
+		t.Errorf("Expected to be logged out, got: %q", res.Stderr)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+
+	res := wftest.Run(t, newApp(), "Written on a plane.", "post", "--offline")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Offline post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if !strings.Contains(res.Stderr, "Saved post to outbox") {
+		t.Errorf("Expected post to be saved to outbox, got: %q", res.Stderr)
+	}
+
+	res = wftest.Run(t, newApp(), "", "outbox", "list")
+	if !strings.Contains(res.Stdout, `post "Written on a plane."`) {
+		t.Errorf("Post isn't listed in outbox: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "outbox", "flush")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Flush failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id := postID(srv, res)
+	if p, ok := srv.Post(id); !ok || p.Content != "Written on a plane." {
+		t.Fatalf("Queued post wasn't published; output: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "posts")
+	if res.Stdout != "Anonymous Posts\n"+id+"\n" {
+		t.Errorf("Queued post isn't listed, posts output: %q", res.Stdout)
+	}
+	res = wftest.Run(t, newApp(), "", "outbox", "list", "-v")
+	if !strings.Contains(res.Stderr, "Outbox is empty.") {
+		t.Errorf("Outbox should be empty, got: %q %q", res.Stdout, res.Stderr)
+	}
+}
+
+func TestDebugLog(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+	logFile := filepath.Join(t.TempDir(), "wf.log")
+
+	res := wftest.Run(t, newApp(), "Traced.", "--debug", "--log-file", logFile, "--log-format", "json")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id := postID(srv, res)
+	res = wftest.Run(t, newApp(), "", "--debug", "--log-file", logFile, "delete", id)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Delete failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if !strings.Contains(res.Stderr, "debug: API request method=DELETE") {
+		t.Errorf("Request wasn't traced to stderr: %q", res.Stderr)
+	}
+
+	b, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The post was logged as JSON, the delete as text
+	var traced bool
+	for _, line := range strings.Split(string(b), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) != nil || entry["msg"] != "API request" {
+			continue
+		}
+		if entry["method"] != "POST" || entry["status"] != float64(201) {
+			t.Errorf("Unexpected trace of post request: %s", line)
+		}
+		traced = true
+	}
+	if !traced {
+		t.Errorf("Post request wasn't traced:\n%s", b)
+	}
+	log := string(b)
+	if !strings.Contains(log, "DEBUG API request method=DELETE") || !strings.Contains(log, "token=REDACTED") {
+		t.Errorf("Delete wasn't traced with its token redacted:\n%s", log)
+	}
+	if strings.Contains(log, "token0000") {
+		t.Errorf("Edit token leaked into log:\n%s", log)
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+
+	// draftIDs returns the IDs of all drafts, most recent first
+	draftIDs := func() []string {
+		res := wftest.Run(t, newApp(), "", "drafts", "list")
+		if res.ExitCode != 0 || res.Err != nil {
+			t.Fatalf("Listing drafts failed: %v\n%s", res.Err, res.Stderr)
+		}
+		ids := []string{}
+		lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+		for _, l := range lines[1:] {
+			ids = append(ids, strings.Fields(l)[0])
+		}
+		return ids
+	}
+
+	// A failing editor leaves the draft behind
+	wftest.Editor(t, `printf 'Written in an editor.\n' >> "$1"; exit 1`)
+	res := wftest.Run(t, newApp(), "", "new", "--font", "serif")
+	if res.ExitCode != commands.ExitError || !strings.Contains(res.Stderr, "Your draft is saved as") {
+		t.Fatalf("Expected editor error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	ids := draftIDs()
+	if len(ids) != 1 {
+		t.Fatalf("Expected 1 draft, got %v", ids)
+	}
+
+	res = wftest.Run(t, newApp(), "", "drafts", "publish", ids[0])
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Publishing draft failed: %v\n%s", res.Err, res.Stderr)
+	}
+	p, ok := srv.Post(postID(srv, res))
+	if !ok || p.Content != "Written in an editor.\n" || p.Font != "norm" {
+		t.Errorf("Draft wasn't published with its front matter: %+v", p)
+	}
+	if ids := draftIDs(); len(ids) != 0 {
+		t.Errorf("Published draft wasn't removed: %v", ids)
+	}
+
+	// An unfinished draft can be resumed
+	res = wftest.Run(t, newApp(), "", "new")
+	if res.ExitCode != commands.ExitError {
+		t.Fatalf("Expected editor error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	wftest.Editor(t, `printf 'And then some more.\n' >> "$1"`)
+	res = wftest.Run(t, newApp(), "", "new", "--resume")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Resuming draft failed: %v\n%s", res.Err, res.Stderr)
+	}
+	p, _ = srv.Post(postID(srv, res))
+	if p.Content != "Written in an editor.\nAnd then some more.\n" {
+		t.Errorf("Resumed draft wasn't published, content is %q", p.Content)
+	}
+
+	// Without a terminal, or with --no-resume, a new draft is started without
+	// asking, and the old ones can be removed
+	wftest.Editor(t, `printf 'Abandoned.\n' >> "$1"; exit 1`)
+	wftest.Run(t, newApp(), "", "new")
+	res = wftest.Run(t, newApp(), "y\n", "new")
+	if strings.Contains(res.Stderr, "Resume unfinished draft") {
+		t.Errorf("Was asked to resume draft without a terminal: %q", res.Stderr)
+	}
+	wftest.Run(t, newApp(), "", "new", "--no-resume")
+	ids = draftIDs()
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 drafts, got %v", ids)
+	}
+	res = wftest.Run(t, newApp(), "", "drafts", "edit", "*")
+	if res.ExitCode != commands.ExitNotFound {
+		t.Errorf("Expected not found for a glob as an ID, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "new", "--resume", "--no-resume")
+	if res.ExitCode != commands.ExitUsage {
+		t.Errorf("Expected usage error for --resume with --no-resume, got %d", res.ExitCode)
+	}
+	res = wftest.Run(t, newApp(), "", append([]string{"drafts", "rm"}, ids...)...)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Removing drafts failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if ids := draftIDs(); len(ids) != 0 {
+		t.Errorf("Drafts weren't removed: %v", ids)
+	}
+}
+
+func TestEncryptedPosts(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+	t.Setenv("WRITEAS_PASSPHRASE", "hunter2")
+
+	res := wftest.Run(t, newApp(), "# Incident notes\n\nThe secret is out.", "post", "--encrypt")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id := postID(srv, res)
+	p, _ := srv.Post(id)
+	if !strings.HasPrefix(p.Content, "-----BEGIN PGP MESSAGE-----") || strings.Contains(p.Content, "secret") || p.Title != "" {
+		t.Errorf("Post wasn't encrypted, got %q: %q", p.Title, p.Content)
+	}
+	if p.Font != "mono" {
+		t.Errorf("Expected encrypted post to be monospace, got %s", p.Font)
+	}
+
+	res = wftest.Run(t, newApp(), "", "get", id)
+	if !strings.Contains(res.Stdout, "-----BEGIN PGP MESSAGE-----") {
+		t.Errorf("Expected armored post without --decrypt, got %q", res.Stdout)
+	}
+	res = wftest.Run(t, newApp(), "", "get", "--decrypt", id)
+	if res.ExitCode != 0 || res.Stdout != "# Incident notes\n\nThe secret is out.\n" {
+		t.Errorf("Post wasn't decrypted, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	t.Setenv("WRITEAS_PASSPHRASE", "wrong")
+	res = wftest.Run(t, newApp(), "", "get", "--decrypt", id)
+	if res.ExitCode != commands.ExitBadToken || !strings.Contains(res.Stderr, "wrong passphrase") {
+		t.Errorf("Expected wrong passphrase error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+
+	// Posts can be encrypted to an age key instead
+	ageID, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := wftest.WriteFile(t, t.TempDir(), "key.txt", ageID.String()+"\n")
+	res = wftest.Run(t, newApp(), "For your eyes only.", "post", "-r", ageID.Recipient().String())
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	id = postID(srv, res)
+	if p, _ := srv.Post(id); !strings.HasPrefix(p.Content, "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Errorf("Post wasn't encrypted with age: %q", p.Content)
+	}
+	res = wftest.Run(t, newApp(), "", "get", "--decrypt", "--key", keyFile, id)
+	if res.ExitCode != 0 || res.Stdout != "For your eyes only.\n" {
+		t.Errorf("Post wasn't decrypted, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	res = wftest.Run(t, newApp(), "", "get", "--decrypt", id)
+	if res.ExitCode != commands.ExitBadToken || !strings.Contains(res.Stderr, "age key") {
+		t.Errorf("Expected missing key error, got %d: %q", res.ExitCode, res.Stderr)
+	}
+}
+
+func TestCodePosts(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+	dir := t.TempDir()
+	code := "package main\n\nfunc main() {}\n"
+
+	tt := []struct {
+		name    string
+		stdin   string
+		args    []string
+		font    string
+		content string
+	}{
+		{"code", code, []string{"post", "--code"}, "code", code},
+		{"code with language", code, []string{"post", "--code=go"}, "norm", "```go\n" + code + "```\n"},
+		{"plain", "Not code.", []string{"post"}, "mono", "Not code."},
+		{"code file", "", []string{"publish", wftest.WriteFile(t, dir, "main.go", code)}, "norm", "```go\n" + code + "```\n"},
+		{"prose file", "", []string{"publish", wftest.WriteFile(t, dir, "notes.md", "Some *notes*.")}, "mono", "Some *notes*."},
+		{"already fenced", "Look:\n\n```go\n" + code + "```\n", []string{"post", "--code=go"}, "norm", "Look:\n\n```go\n" + code + "```\n"},
+	}
+	for _, tc := range tt {
+		res := wftest.Run(t, newApp(), tc.stdin, tc.args...)
+		if res.ExitCode != 0 || res.Err != nil {
+			t.Fatalf("%s: post failed: %v\n%s", tc.name, res.Err, res.Stderr)
+		}
+		p, _ := srv.Post(postID(srv, res))
+		if p.Font != tc.font || p.Content != tc.content {
+			t.Errorf("%s: expected %s post %q, got %s post %q", tc.name, tc.font, tc.content, p.Font, p.Content)
+		}
+	}
+}
+
+func TestPublishFiles(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+	dir := t.TempDir()
+	goFile := wftest.WriteFile(t, dir, "main.go", "package main\n")
+	yamlFile := wftest.WriteFile(t, dir, "config.yaml", "key: \"```\"\n")
+	logFile := wftest.WriteFile(t, dir, "logs.txt", "panic: oops\n")
+
+	res := wftest.Run(t, newApp(), "", "publish", goFile, yamlFile, logFile)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Publish failed: %v\n%s", res.Err, res.Stderr)
+	}
+	p, _ := srv.Post(postID(srv, res))
+	expected := "## main.go\n\n```go\npackage main\n```\n\n" +
+		"## config.yaml\n\n````yaml\nkey: \"```\"\n````\n\n" +
+		"## logs.txt\n\n```\npanic: oops\n```\n"
+	if p.Content != expected || p.Font != "norm" {
+		t.Errorf("Expected %q, got %s post %q", expected, p.Font, p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "", "publish", "--separate", goFile, logFile)
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Publish failed: %v\n%s", res.Err, res.Stderr)
+	}
+	urls := strings.Fields(res.Stdout)
+	if len(urls) != 2 {
+		t.Fatalf("Expected 2 URLs, got %q", res.Stdout)
+	}
+	if p, _ := srv.Post(strings.TrimPrefix(urls[1], srv.URL+"/")); p.Content != "panic: oops\n" {
+		t.Errorf("Unexpected content of second post: %q", p.Content)
+	}
+
+	res = wftest.Run(t, newApp(), "", "publish", "--separate", goFile, filepath.Join(dir, "missing.txt"))
+	if res.ExitCode != commands.ExitError || !strings.Contains(res.Stderr, "missing.txt") || len(strings.Fields(res.Stdout)) != 1 {
+		t.Errorf("Expected one post and an error, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+}
+
+func TestExpiringPosts(t *testing.T) {
+	srv := setUp(t)
+	logIn(t)
+
+	res := wftest.Run(t, newApp(), "Gone soon.", "post", "--expire", "soon")
+	if res.ExitCode != commands.ExitUsage || res.Stdout != "" {
+		t.Errorf("Expected invalid --expire to fail before posting, got %d: %q", res.ExitCode, res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "Here all week.", "post", "--expire", "7d")
+	keep := postID(srv, res)
+	res = wftest.Run(t, newApp(), "Gone already.", "post", "--expire", "1ms")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("Post failed: %v\n%s", res.Err, res.Stderr)
+	}
+	gone := postID(srv, res)
+	wftest.Run(t, newApp(), "Written on a plane.", "post", "--offline", "--expire", "1ms")
+	res = wftest.Run(t, newApp(), "", "outbox", "flush")
+	queued := postID(srv, res)
+
+	res = wftest.Run(t, newApp(), "", "gc", "--dry-run")
+	if !strings.Contains(res.Stdout, "Would delete "+gone) || !strings.Contains(res.Stdout, "Would delete "+queued) || strings.Contains(res.Stdout, keep) {
+		t.Errorf("Unexpected dry run output: %q", res.Stdout)
+	}
+	if _, ok := srv.Post(gone); !ok {
+		t.Fatalf("Dry run deleted post")
+	}
+
+	res = wftest.Run(t, newApp(), "", "gc")
+	if res.ExitCode != 0 || res.Err != nil {
+		t.Fatalf("gc failed: %v\n%s", res.Err, res.Stderr)
+	}
+	if !strings.Contains(res.Stdout, "Deleted "+gone) || !strings.Contains(res.Stdout, "Deleted "+queued) {
+		t.Errorf("Expected expired posts to be reported, got: %q", res.Stdout)
+	}
+	for _, id := range []string{gone, queued} {
+		if _, ok := srv.Post(id); ok {
+			t.Errorf("Expired post %s wasn't deleted", id)
+		}
+	}
+	if _, ok := srv.Post(keep); !ok {
+		t.Errorf("Post that hasn't expired was deleted")
+	}
+	res = wftest.Run(t, newApp(), "", "posts")
+	if res.Stdout != "Anonymous Posts\n"+keep+"\n" {
+		t.Errorf("Deleted posts are still stored locally, posts output: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "gc")
+	if res.ExitCode != 0 || res.Stdout != "" {
+		t.Errorf("Expected nothing left to delete, got %d: %q", res.ExitCode, res.Stdout)
+	}
+}
+
+func TestDeleteAllAnonymous(t *testing.T) {
+	srv := setUp(t)
+	var ids []string
+	for _, body := range []string{"First thought.", "Second thought."} {
+		ids = append(ids, addAnonymous(t, srv, body))
+	}
+	// The user's own posts aren't anonymous, even if they aren't on a blog
+	logIn(t)
+	own := srv.AddPost("matt", "", "", "My own thought.")
+
+	res := wftest.Run(t, newApp(), "", "delete", "--all-anonymous", "--dry-run")
+	if res.ExitCode != 0 || !strings.Contains(res.Stdout, "First thought.") || !strings.Contains(res.Stdout, "Second thought.") {
+		t.Errorf("Expected both posts to be listed, got %d: %q\n%s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+	if strings.Contains(res.Stdout, "My own thought.") {
+		t.Errorf("The user's own post was listed as anonymous: %q", res.Stdout)
+	}
+
+	res = wftest.Run(t, newApp(), "", "delete", "--all-anonymous", "--yes")
+	if res.ExitCode != 0 || !strings.Contains(res.Stderr, "2 deleted, 0 failed") {
+		t.Fatalf("Delete failed, got %d: %q", res.ExitCode, res.Stderr)
+	}
+	for _, id := range ids {
+		if _, ok := srv.Post(id); ok {
+			t.Errorf("Post %s wasn't deleted", id)
+		}
+	}
+	if _, ok := srv.Post(own.ID); !ok {
+		t.Errorf("The user's own post was deleted")
+	}
+	res = wftest.Run(t, newApp(), "", "posts")
+	for _, id := range ids {
+		if strings.Contains(res.Stdout, id) {
+			t.Errorf("Deleted posts are still stored locally, posts output: %q", res.Stdout)
+		}
+	}
+}
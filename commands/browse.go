@@ -0,0 +1,488 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/atotto/clipboard"
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/writeas-cli/api"
+	"golang.org/x/term"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// The lists shown by browse, in the order of their tabs.
+const (
+	tabPosts = iota
+	tabDrafts
+	tabBlogs
+	numTabs
+)
+
+// browser is the state of the post browser. It's kept apart from the
+// terminal, so it can be driven by a script as well as by the user.
+type browser struct {
+	c *cli.Context
+	s *api.Session
+
+	posts  []writeas.Post
+	drafts []api.Draft
+	blogs  []api.RemoteColl
+
+	tab int
+	// blog, if set, keeps only the posts on the blog with this alias.
+	blog string
+	// sel is the selected row in each tab, and top the first row shown.
+	sel [numTabs]int
+	top [numTabs]int
+
+	// While choosing, the list is replaced by choices of blog aliases, where
+	// "" means no blog. chosen is called with the one picked.
+	choosing bool
+	choices  []string
+	choice   int
+	chosen   func(alias string)
+	// confirmed, if set, is called if the user answers yes to prompt.
+	confirmed func()
+	prompt    string
+
+	status string
+	quit   bool
+	// suspend gives the terminal back to run the given function, like an
+	// editor, then takes it again.
+	suspend func(func() error) error
+	// openURL and copyText open a link in the browser and copy text to the
+	// clipboard. Scripts replace them, so they can't start other programs.
+	openURL  func(url string) error
+	copyText func(text string) error
+}
+
+// CmdBrowse lists the user's posts, drafts and blogs in the terminal, with a
+// preview of the selected one, and keys to edit, publish, move and delete
+// them. With --script, the keys are read from a file instead, and the screen
+// is written to stdout, so it can be run without a terminal.
+func CmdBrowse(c *cli.Context) error {
+	var script []string
+	if name := c.String("script"); name != "" {
+		var text []byte
+		var err error
+		if name == "-" {
+			text, err = readStdIn()
+		} else {
+			text, err = ioutil.ReadFile(name)
+		}
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Couldn't read script: %v", err), ExitError)
+		}
+		script, err = parseScript(string(text))
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid script: %v", err), ExitUsage)
+		}
+	} else if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return cli.NewExitError("browse needs a terminal. To run it without one, give the keys to press with --script.", ExitUsage)
+	}
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	b := &browser{c: c, s: s, openURL: openURL, copyText: clipboard.WriteAll}
+	if err := b.load(); err != nil {
+		return exitErrorf(err, "Couldn't get posts: %v", err)
+	}
+	if script != nil {
+		b.runScript(os.Stdout, script)
+		return nil
+	}
+	if err := b.runTerminal(); err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	return nil
+}
+
+// load reads the user's drafts, and fetches their posts and blogs if they're
+// logged in.
+func (b *browser) load() error {
+	var err error
+	b.drafts, err = b.s.Drafts()
+	if err != nil {
+		return err
+	}
+	if !b.s.LoggedIn() {
+		return nil
+	}
+	b.posts, err = b.s.UserPosts()
+	if err != nil {
+		return err
+	}
+	b.blogs, err = b.s.Collections()
+	return err
+}
+
+// visiblePosts returns the posts in the posts tab.
+func (b *browser) visiblePosts() []*writeas.Post {
+	posts := []*writeas.Post{}
+	for i := range b.posts {
+		p := &b.posts[i]
+		if b.blog == "" || (p.Collection != nil && p.Collection.Alias == b.blog) {
+			posts = append(posts, p)
+		}
+	}
+	return posts
+}
+
+// rows returns how many rows the given tab has.
+func (b *browser) rows(tab int) int {
+	switch tab {
+	case tabPosts:
+		return len(b.visiblePosts())
+	case tabDrafts:
+		return len(b.drafts)
+	}
+	return len(b.blogs)
+}
+
+// selectedPost returns the selected post, if the posts tab is shown and has
+// any.
+func (b *browser) selectedPost() *writeas.Post {
+	if posts := b.visiblePosts(); b.tab == tabPosts && b.sel[tabPosts] < len(posts) {
+		return posts[b.sel[tabPosts]]
+	}
+	return nil
+}
+
+func (b *browser) selectedDraft() *api.Draft {
+	if b.tab == tabDrafts && b.sel[tabDrafts] < len(b.drafts) {
+		return &b.drafts[b.sel[tabDrafts]]
+	}
+	return nil
+}
+
+func (b *browser) selectedBlog() *api.RemoteColl {
+	if b.tab == tabBlogs && b.sel[tabBlogs] < len(b.blogs) {
+		return &b.blogs[b.sel[tabBlogs]]
+	}
+	return nil
+}
+
+// step moves the selection by the given number of rows, stopping at either
+// end of the list.
+func (b *browser) step(n int) {
+	sel := b.sel[b.tab] + n
+	if sel >= b.rows(b.tab) {
+		sel = b.rows(b.tab) - 1
+	}
+	if sel < 0 {
+		sel = 0
+	}
+	b.sel[b.tab] = sel
+}
+
+// handleKey acts on a single key press, named as in parseKey.
+func (b *browser) handleKey(key string) {
+	if b.confirmed != nil {
+		confirmed := b.confirmed
+		b.confirmed, b.prompt = nil, ""
+		if key == "y" || key == "Y" {
+			confirmed()
+		} else {
+			b.status = "Cancelled."
+		}
+		return
+	}
+	if b.choosing {
+		b.handleChoice(key)
+		return
+	}
+
+	b.status = ""
+	switch key {
+	case "q", "ctrl+c":
+		b.quit = true
+	case "tab", "right":
+		b.tab = (b.tab + 1) % numTabs
+	case "backtab", "left":
+		b.tab = (b.tab + numTabs - 1) % numTabs
+	case "1", "2", "3":
+		b.tab = int(key[0] - '1')
+	case "up", "k":
+		b.step(-1)
+	case "down", "j":
+		b.step(1)
+	case "pgup":
+		b.step(-10)
+	case "pgdn":
+		b.step(10)
+	case "home", "g":
+		b.sel[b.tab] = 0
+	case "end", "G":
+		b.step(b.rows(b.tab))
+	case "esc":
+		if b.tab == tabPosts && b.blog != "" {
+			b.blog = ""
+			b.sel[tabPosts] = 0
+		}
+	case "enter":
+		if blog := b.selectedBlog(); blog != nil {
+			b.blog = blog.Alias
+			b.tab = tabPosts
+			b.sel[tabPosts] = 0
+			return
+		}
+		b.edit()
+	case "e":
+		b.edit()
+	case "p":
+		b.publish()
+	case "m":
+		b.move()
+	case "d":
+		b.remove()
+	case "c":
+		b.copyURL()
+	case "o":
+		b.open()
+	case "r":
+		b.finish(nil, "Refreshed.")
+	}
+}
+
+func (b *browser) handleChoice(key string) {
+	switch key {
+	case "up", "k":
+		if b.choice > 0 {
+			b.choice--
+		}
+	case "down", "j":
+		if b.choice < len(b.choices)-1 {
+			b.choice++
+		}
+	case "enter":
+		alias, chosen := b.choices[b.choice], b.chosen
+		b.endChoice()
+		chosen(alias)
+	case "esc", "q", "ctrl+c":
+		b.endChoice()
+		b.status = "Cancelled."
+	}
+}
+
+// choose asks the user to pick one of the given blog aliases, starting at the
+// current one, and calls chosen with it.
+func (b *browser) choose(prompt string, choices []string, current string, chosen func(alias string)) {
+	b.choosing, b.prompt, b.choices, b.chosen = true, prompt, choices, chosen
+	b.choice = 0
+	for i, alias := range choices {
+		if alias == current {
+			b.choice = i
+		}
+	}
+}
+
+func (b *browser) endChoice() {
+	b.choosing, b.prompt, b.choices, b.chosen = false, "", nil, nil
+}
+
+// confirm asks the user a yes or no question, and calls confirmed if they
+// answer yes.
+func (b *browser) confirm(prompt string, confirmed func()) {
+	b.prompt = prompt + " [y/N]"
+	b.confirmed = confirmed
+}
+
+// blogChoices returns the aliases of the user's blogs, except the given one,
+// followed by "" for no blog, if noBlog is true.
+func (b *browser) blogChoices(except string, noBlog bool) []string {
+	choices := []string{}
+	for _, blog := range b.blogs {
+		if blog.Alias != except {
+			choices = append(choices, blog.Alias)
+		}
+	}
+	if noBlog {
+		choices = append(choices, "")
+	}
+	return choices
+}
+
+// finish shows the outcome of an action, then reloads everything, since any
+// of it may have changed.
+func (b *browser) finish(err error, msg string) {
+	if err != nil {
+		b.status = err.Error()
+	} else {
+		b.status = msg
+	}
+	if err := b.load(); err != nil {
+		b.status = fmt.Sprintf("%s Couldn't refresh: %v", b.status, err)
+	}
+	for tab := 0; tab < numTabs; tab++ {
+		if b.sel[tab] >= b.rows(tab) {
+			b.sel[tab] = b.rows(tab) - 1
+		}
+		if b.sel[tab] < 0 {
+			b.sel[tab] = 0
+		}
+	}
+}
+
+// edit opens the selected post or draft in the user's editor.
+func (b *browser) edit() {
+	if p := b.selectedPost(); p != nil {
+		err := b.suspend(func() error {
+			current, err := b.s.GetPost(p.ID)
+			if err != nil {
+				return err
+			}
+			return editRemotePost(b.c, b.s, current)
+		})
+		b.finish(err, "Edited "+p.ID+".")
+	} else if d := b.selectedDraft(); d != nil {
+		err := b.suspend(func() error {
+			return editPost(b.c, d.Path)
+		})
+		b.finish(err, "Saved draft "+d.ID+".")
+	}
+}
+
+// publish publishes the selected draft on the blog the user chooses. Posts
+// on the server that aren't on a blog are moved to the chosen one.
+func (b *browser) publish() {
+	if p := b.selectedPost(); p != nil {
+		if p.Collection != nil {
+			b.status = fmt.Sprintf("%s is already on %s. To move it, press m.", p.ID, p.Collection.Alias)
+			return
+		}
+		if len(b.blogs) == 0 {
+			b.status = "You don't have any blogs to publish to."
+			return
+		}
+		id := p.ID
+		b.choose("Publish "+id+" on:", b.blogChoices("", false), "", func(alias string) {
+			moved, err := b.s.MovePost(id, alias)
+			if err != nil {
+				b.finish(err, "")
+				return
+			}
+			b.finish(nil, "Published "+b.s.PostURL(moved))
+		})
+	} else if d := b.selectedDraft(); d != nil {
+		if len(bytes.TrimSpace(d.Body)) == 0 {
+			b.status = "Draft " + d.ID + " is empty."
+			return
+		}
+		draft := *d
+		b.choose("Change blog of draft "+d.ID+" to:", b.blogChoices("", true), d.Blog, func(alias string) {
+			draft.Blog = alias
+			p, err := b.s.Publish(draft.PostParams())
+			if err != nil {
+				b.finish(err, "")
+				return
+			}
+			if err := b.s.DeleteDraft(draft.ID); err != nil {
+				b.finish(nil, fmt.Sprintf("Published %s, but couldn't remove the draft: %v", b.s.PostURL(p), err))
+				return
+			}
+			b.finish(nil, "Published "+b.s.PostURL(p))
+		})
+	} else if b.tab == tabBlogs {
+		b.status = "Choose a post or draft to publish."
+	}
+}
+
+// move moves the selected post to the blog the user chooses, or to their
+// drafts. For local drafts, it changes the blog they'll be published on.
+func (b *browser) move() {
+	if p := b.selectedPost(); p != nil {
+		current := ""
+		if p.Collection != nil {
+			current = p.Collection.Alias
+		}
+		choices := b.blogChoices(current, current != "")
+		if len(choices) == 0 {
+			b.status = "You don't have any other blogs to move it to."
+			return
+		}
+		id := p.ID
+		b.choose("Move "+id+" to:", choices, "", func(alias string) {
+			_, err := b.s.MovePost(id, alias)
+			if alias == "" {
+				b.finish(err, "Moved "+id+" to your drafts.")
+			} else {
+				b.finish(err, "Moved "+id+" to "+alias+".")
+			}
+		})
+	} else if d := b.selectedDraft(); d != nil {
+		draft := *d
+		b.choose("Change blog of draft "+d.ID+" to:", b.blogChoices("", true), d.Blog, func(alias string) {
+			draft.Blog = alias
+			err := b.s.SaveDraft(&draft)
+			if alias == "" {
+				b.finish(err, "Draft "+draft.ID+" will be published without a blog.")
+			} else {
+				b.finish(err, "Draft "+draft.ID+" will be published on "+alias+".")
+			}
+		})
+	} else if b.tab == tabBlogs {
+		b.status = "Choose a post or draft to move."
+	}
+}
+
+// remove deletes the selected post or draft, once the user confirms it.
+func (b *browser) remove() {
+	if p := b.selectedPost(); p != nil {
+		id := p.ID
+		b.confirm(fmt.Sprintf("Delete %s (%q)?", id, api.PostTitle(p)), func() {
+			err := deletePost(b.c, b.s, id, b.s.TokenFromID(id))
+			b.finish(err, "Deleted "+id+".")
+		})
+	} else if d := b.selectedDraft(); d != nil {
+		id := d.ID
+		b.confirm(fmt.Sprintf("Delete draft %s (%q)?", id, d.Summary()), func() {
+			b.finish(b.s.DeleteDraft(id), "Deleted draft "+id+".")
+		})
+	} else if b.tab == tabBlogs {
+		b.status = "Blogs can't be deleted here."
+	}
+}
+
+// selectedURL returns the URL of the selected post or blog, or "" if it
+// doesn't have one.
+func (b *browser) selectedURL() string {
+	if p := b.selectedPost(); p != nil {
+		return b.s.PostURL(p)
+	}
+	if blog := b.selectedBlog(); blog != nil {
+		return blog.URL
+	}
+	if b.selectedDraft() != nil {
+		b.status = "Drafts don't have a URL until they're published."
+	}
+	return ""
+}
+
+func (b *browser) copyURL() {
+	url := b.selectedURL()
+	if url == "" {
+		return
+	}
+	if err := b.copyText(url); err != nil {
+		b.status = fmt.Sprintf("Couldn't copy %s: %v", url, err)
+		return
+	}
+	b.status = "Copied " + url
+}
+
+func (b *browser) open() {
+	url := b.selectedURL()
+	if url == "" {
+		return
+	}
+	if err := b.suspend(func() error { return b.openURL(url) }); err != nil {
+		b.status = fmt.Sprintf("Couldn't open %s: %v", url, err)
+		return
+	}
+	b.status = "Opened " + url
+}
@@ -0,0 +1,402 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/writeas/writeas-cli/api"
+	"golang.org/x/term"
+)
+
+const (
+	// previewLines is the height of the preview of the selected item.
+	previewLines = 4
+	// The size of the screen written by scripts.
+	scriptWidth  = 80
+	scriptHeight = 24
+)
+
+// scriptKeys are the names of keys that can be pressed in a script, besides
+// single characters. print writes the screen as it is at that point.
+var scriptKeys = map[string]bool{
+	"up": true, "down": true, "left": true, "right": true,
+	"pgup": true, "pgdn": true, "home": true, "end": true,
+	"enter": true, "esc": true, "tab": true, "backtab": true,
+	"space": true, "backspace": true, "ctrl+c": true,
+	"print": true,
+}
+
+// parseScript returns the keys to press in the given script: key names or
+// single characters, separated by spaces or lines. Lines starting with # are
+// ignored.
+func parseScript(text string) ([]string, error) {
+	keys := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, k := range strings.Fields(line) {
+			if utf8.RuneCountInString(k) != 1 && !scriptKeys[k] {
+				return nil, fmt.Errorf("unknown key %q", k)
+			}
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// parseKey returns the name of the key pressed, given what the terminal
+// sent for it, or "" if it isn't one browse knows.
+func parseKey(b []byte) string {
+	switch string(b) {
+	case "\x1b[A", "\x1bOA":
+		return "up"
+	case "\x1b[B", "\x1bOB":
+		return "down"
+	case "\x1b[C", "\x1bOC":
+		return "right"
+	case "\x1b[D", "\x1bOD":
+		return "left"
+	case "\x1b[5~":
+		return "pgup"
+	case "\x1b[6~":
+		return "pgdn"
+	case "\x1b[H", "\x1bOH", "\x1b[1~":
+		return "home"
+	case "\x1b[F", "\x1bOF", "\x1b[4~":
+		return "end"
+	case "\x1b[Z":
+		return "backtab"
+	case "\x1b":
+		return "esc"
+	case "\r", "\n":
+		return "enter"
+	case "\t":
+		return "tab"
+	case " ":
+		return "space"
+	case "\x7f", "\b":
+		return "backspace"
+	case "\x03":
+		return "ctrl+c"
+	}
+	if r, size := utf8.DecodeRune(b); size == len(b) && r != utf8.RuneError && r >= ' ' {
+		return string(r)
+	}
+	return ""
+}
+
+// runScript presses the given keys, writing the screen to w where the
+// script says to print it, and at the end. The editor is still run, but
+// links aren't opened or copied, so a script never starts a browser or
+// needs a clipboard; the status says they were, as it would otherwise.
+func (b *browser) runScript(w io.Writer, keys []string) {
+	b.suspend = func(f func() error) error { return f() }
+	b.openURL = func(string) error { return nil }
+	b.copyText = func(string) error { return nil }
+	printed := false
+	for _, k := range keys {
+		if b.quit {
+			break
+		}
+		if printed = k == "print"; printed {
+			b.writeScreen(w)
+			continue
+		}
+		b.handleKey(k)
+	}
+	if !printed {
+		b.writeScreen(w)
+	}
+}
+
+// writeScreen writes the screen as plain text, followed by a blank line.
+func (b *browser) writeScreen(w io.Writer) {
+	lines, _ := b.render(scriptWidth, scriptHeight)
+	for _, l := range lines {
+		fmt.Fprintln(w, strings.TrimRight(l, " "))
+	}
+	fmt.Fprintln(w)
+}
+
+// runTerminal shows the browser on the terminal until the user quits.
+func (b *browser) runTerminal() error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	var state *term.State
+	start := func() error {
+		var err error
+		state, err = term.MakeRaw(in)
+		if err != nil {
+			return err
+		}
+		// Switch to the alternate screen, and hide the cursor
+		fmt.Print("\x1b[?1049h\x1b[?25l")
+		return nil
+	}
+	stop := func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.Restore(in, state)
+	}
+	b.suspend = func(f func() error) error {
+		stop()
+		defer start()
+		return f()
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	defer stop()
+
+	buf := make([]byte, 16)
+	for !b.quit {
+		width, height, err := term.GetSize(out)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = scriptWidth, scriptHeight
+		}
+		lines, selected := b.render(width, height)
+		var screen bytes.Buffer
+		screen.WriteString("\x1b[H\x1b[2J")
+		for i, l := range lines {
+			if i > 0 {
+				screen.WriteString("\r\n")
+			}
+			if i == selected {
+				l = "\x1b[7m" + l + "\x1b[0m"
+			}
+			screen.WriteString(l)
+		}
+		os.Stdout.Write(screen.Bytes())
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		b.handleKey(parseKey(buf[:n]))
+	}
+	return nil
+}
+
+// render returns the lines of the screen, each padded or cut to the given
+// width, and which of them is selected, or -1 if none is.
+func (b *browser) render(width, height int) ([]string, int) {
+	listHeight := height - previewLines - 6
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	rule := strings.Repeat("─", width)
+
+	lines := []string{b.tabBar(), rule}
+	selected := -1
+	var rows []string
+	var sel *int
+	if b.choosing {
+		rows = []string{b.prompt}
+		for _, alias := range b.choices {
+			rows = append(rows, "  "+b.blogLabel(alias))
+		}
+		choice := b.choice + 1
+		sel = &choice
+	} else {
+		rows = b.listRows()
+		sel = &b.sel[b.tab]
+	}
+
+	// Scroll to keep the selection in view
+	top := &b.top[b.tab]
+	if b.choosing {
+		top = new(int)
+	}
+	if *sel < *top {
+		*top = *sel
+	} else if *sel >= *top+listHeight {
+		*top = *sel - listHeight + 1
+	}
+	for i := *top; i < *top+listHeight; i++ {
+		if i >= len(rows) {
+			lines = append(lines, "")
+			continue
+		}
+		row := rows[i]
+		if i == *sel && (b.choosing || b.rows(b.tab) > 0) {
+			row = ">" + row[1:]
+			selected = len(lines)
+		}
+		lines = append(lines, row)
+	}
+
+	lines = append(lines, rule)
+	lines = append(lines, b.preview()...)
+	status := b.status
+	if b.prompt != "" && !b.choosing {
+		status = b.prompt
+	}
+	lines = append(lines, rule, strings.Replace(status, "\n", " ", -1), b.help())
+
+	for i, l := range lines {
+		lines[i] = fitWidth(l, width)
+	}
+	return lines, selected
+}
+
+// tabBar returns the names of the tabs, with the current one in brackets.
+func (b *browser) tabBar() string {
+	posts := fmt.Sprintf("Posts (%d)", b.rows(tabPosts))
+	if b.blog != "" {
+		posts = fmt.Sprintf("Posts on %s (%d)", b.blog, b.rows(tabPosts))
+	}
+	names := []string{posts, fmt.Sprintf("Drafts (%d)", len(b.drafts)), fmt.Sprintf("Blogs (%d)", len(b.blogs))}
+	for i := range names {
+		if i == b.tab {
+			names[i] = "[" + names[i] + "]"
+		} else {
+			names[i] = " " + names[i] + " "
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// listRows returns a line for each row of the current tab, indented to make
+// room for the selection marker.
+func (b *browser) listRows() []string {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	switch b.tab {
+	case tabPosts:
+		if !b.s.LoggedIn() {
+			return []string{"  Log in to see your posts."}
+		}
+		for _, p := range b.visiblePosts() {
+			blog := ""
+			if p.Collection != nil {
+				blog = p.Collection.Alias
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", p.ID, p.Created.Local().Format("2006-01-02"), blogName(blog), api.PostTitle(p))
+		}
+	case tabDrafts:
+		for _, d := range b.drafts {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", d.ID, d.Modified.Local().Format("2006-01-02 15:04"), blogName(d.Blog), d.Summary())
+		}
+	case tabBlogs:
+		for _, blog := range b.blogs {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", blog.Alias, blog.Title, countPosts(b.blogPosts(blog.Alias)))
+		}
+	}
+	tw.Flush()
+	if buf.Len() == 0 {
+		return []string{"  " + [numTabs]string{"No posts.", "No drafts.", "No blogs."}[b.tab]}
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// blogPosts returns how many of the user's posts are on the given blog.
+func (b *browser) blogPosts(alias string) int {
+	n := 0
+	for _, p := range b.posts {
+		if p.Collection != nil && p.Collection.Alias == alias {
+			n++
+		}
+	}
+	return n
+}
+
+// countPosts returns "1 post" or "n posts".
+func countPosts(n int) string {
+	if n == 1 {
+		return "1 post"
+	}
+	return fmt.Sprintf("%d posts", n)
+}
+
+// blogLabel returns how the given blog is shown when choosing one.
+func (b *browser) blogLabel(alias string) string {
+	if alias == "" {
+		return "-  No blog"
+	}
+	for _, blog := range b.blogs {
+		if blog.Alias == alias {
+			return alias + "  " + blog.Title
+		}
+	}
+	return alias
+}
+
+// preview returns the lines describing the selected item: its title, where
+// it is, and an excerpt.
+func (b *browser) preview() []string {
+	var title, info, excerpt string
+	if p := b.selectedPost(); p != nil {
+		blog := "Not on a blog"
+		if p.Collection != nil {
+			blog = "On " + p.Collection.Alias
+		}
+		title = api.PostTitle(p)
+		info = fmt.Sprintf("%s, published %s  %s", blog, p.Created.Local().Format("2006-01-02"), b.s.PostURL(p))
+		excerpt = api.Excerpt(p.Content)
+	} else if d := b.selectedDraft(); d != nil {
+		blog := "without a blog"
+		if d.Blog != "" {
+			blog = "on " + d.Blog
+		}
+		title = d.Summary()
+		info = fmt.Sprintf("Draft to publish %s, changed %s", blog, d.Modified.Local().Format("2006-01-02 15:04"))
+		excerpt = api.Excerpt(string(d.Body))
+	} else if blog := b.selectedBlog(); blog != nil {
+		title = blog.Title
+		info = blog.URL
+		excerpt = countPosts(b.blogPosts(blog.Alias))
+	}
+	lines := append([]string{title, info}, strings.Split(excerpt, "\n")...)
+	for len(lines) < previewLines {
+		lines = append(lines, "")
+	}
+	return lines[:previewLines]
+}
+
+// help returns the keys that can be pressed.
+func (b *browser) help() string {
+	switch {
+	case b.choosing:
+		return "up/down choose  enter select  esc cancel"
+	case b.tab == tabPosts:
+		return "tab switch  e edit  p publish  m move  d delete  c copy URL  o open  q quit"
+	case b.tab == tabDrafts:
+		return "tab switch  e edit  p publish  m change blog  d delete  r refresh  q quit"
+	}
+	return "tab switch  enter show posts  c copy URL  o open  r refresh  q quit"
+}
+
+// fitWidth pads or cuts the given line to the given number of characters.
+func fitWidth(line string, width int) string {
+	n := utf8.RuneCountInString(line)
+	if n > width {
+		return string([]rune(line)[:width])
+	}
+	return line + strings.Repeat(" ", width-n)
+}
+
+// openURL opens the given URL with the browser in $BROWSER, or else the
+// system's default one.
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	if browser := os.Getenv("BROWSER"); browser != "" {
+		cmd = exec.Command(browser, url)
+	} else {
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", url)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		default:
+			cmd = exec.Command("xdg-open", url)
+		}
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -1,13 +1,19 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/howeyc/gopass"
+	writeas "github.com/writeas/go-writeas/v2"
 	"github.com/writeas/writeas-cli/api"
 	"github.com/writeas/writeas-cli/config"
 	"github.com/writeas/writeas-cli/executable"
@@ -16,34 +22,65 @@ import (
 )
 
 func CmdPost(c *cli.Context) error {
+	p, err := readStdIn()
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+
 	if config.IsTor(c) {
 		log.Info(c, "Publishing via hidden service...")
 	} else {
 		log.Info(c, "Publishing...")
 	}
 
-	_, err := api.DoPost(c, api.ReadStdIn(), c.String("font"), false, c.Bool("code"))
+	fm, p := codePost(postFrontMatter(c), p, config.CodeLang(c))
+	err = postOrQueue(c, fm, p)
 	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+		return exitError(err)
 	}
 	return nil
 }
 
 func CmdNew(c *cli.Context) error {
-	fname, p := api.ComposeNewPost()
-	if p == nil {
-		// Assume composeNewPost already told us what the error was. Abort now.
-		os.Exit(1)
+	if c.Bool("resume") && c.Bool("no-resume") {
+		return usageError("new [--resume | --no-resume]")
+	}
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	d, err := resumeDraft(c, s)
+	if err != nil {
+		return exitErrorf(err, "Couldn't check for a draft to resume: %v", err)
+	}
+	if d == nil {
+		// The editor works on the draft itself, so nothing written is lost
+		// if publishing fails or never happens.
+		fm := postFrontMatter(c)
+		d, err = s.NewDraft(fm, config.EditorExt(fm.Font, c.Bool("md")))
+		if err != nil {
+			return exitError(err)
+		}
+	}
+
+	if err := editPost(c, d.Path); err != nil {
+		return cli.NewExitError(fmt.Sprintf("%s\n%s", err, draftSavedMessage(d.ID)), ExitError)
+	}
+	edited, err := s.Draft(d.ID)
+	if err != nil {
+		return exitError(err)
+	}
+	if edited.FrontMatter.IsZero() {
+		// Some editors, like 'copy con' on Windows, replace the whole file
+		edited.FrontMatter = d.FrontMatter
 	}
 
 	// Ensure we have something to post
-	if len(*p) == 0 {
-		// Clean up temporary post
-		if fname != "" {
-			os.Remove(fname)
-		}
+	if len(bytes.TrimSpace(edited.Body)) == 0 {
+		s.DeleteDraft(d.ID)
 
-		log.InfolnQuit("Empty post. Bye!")
+		log.Errorln("Empty post. Bye!")
+		return nil
 	}
 
 	if config.IsTor(c) {
@@ -52,25 +89,64 @@ func CmdNew(c *cli.Context) error {
 		log.Info(c, "Publishing...")
 	}
 
-	_, err := api.DoPost(c, *p, c.String("font"), false, c.Bool("code"))
+	err = publishDraft(c, s, edited)
 	if err != nil {
-		log.Errorln("Error posting: %s\n%s", err, config.MessageRetryCompose(fname))
-		return cli.NewExitError("", 1)
+		if _, queued := err.(*queuedError); queued {
+			// Post is safe in the outbox, and the draft was removed
+			return exitError(err)
+		}
+		return exitErrorf(err, "Error posting: %s\n%s", err, draftSavedMessage(d.ID))
+	}
+	return nil
+}
+
+func CmdPublish(c *cli.Context) error {
+	files := c.Args()
+	if len(files) == 0 {
+		return usageError("publish [--separate] <filename>...")
+	}
+	if len(files) == 1 {
+		if err := publishFile(c, files[0]); err != nil {
+			return exitError(err)
+		}
+		return nil
 	}
 
-	// Clean up temporary post
-	if fname != "" {
-		os.Remove(fname)
+	if c.Bool("separate") {
+		code := ExitOK
+		for _, fname := range files {
+			if err := publishFile(c, fname); err != nil {
+				log.Errorln("%s: %v", fname, err)
+				code = combineExitCode(code, err)
+			}
+		}
+		if code != ExitOK {
+			return cli.NewExitError("", code)
+		}
+		return nil
 	}
 
+	content, err := pasteFiles(files)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	if config.IsTor(c) {
+		log.Info(c, "Publishing %d files via hidden service...", len(files))
+	} else {
+		log.Info(c, "Publishing %d files...", len(files))
+	}
+	fm := postFrontMatter(c)
+	if !config.IsMarkdownFont(fm.Font) {
+		fm.Font = string(config.PostFontNormal)
+	}
+	if err := postOrQueue(c, fm, content); err != nil {
+		return exitError(err)
+	}
 	return nil
 }
 
-func CmdPublish(c *cli.Context) error {
-	filename := c.Args().Get(0)
-	if filename == "" {
-		return cli.NewExitError("usage: "+executable.Name()+" publish <filename>", 1)
-	}
+// publishFile publishes the given file as a post of its own.
+func publishFile(c *cli.Context, filename string) error {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
@@ -81,44 +157,264 @@ func CmdPublish(c *cli.Context) error {
 	} else {
 		log.Info(c, "Publishing...")
 	}
-	_, err = api.DoPost(c, content, c.String("font"), false, c.Bool("code"))
-	if err != nil {
-		return cli.NewExitError(err.Error(), 1)
+	// Code files are highlighted in their language, unless told otherwise
+	lang := config.CodeLang(c)
+	if lang == "" && !c.IsSet("font") && !c.GlobalIsSet("font") {
+		lang = config.CodeLangFromFilename(filename)
+		if lang != "" {
+			log.Info(c, "Publishing %s as %s code", filename, lang)
+		}
 	}
+	fm := postFrontMatter(c)
+	if lang == "" {
+		fm, content = fileFrontMatter(c, fm, content)
+	}
+	fm, content = codePost(fm, content, lang)
 
 	// TODO: write local file if directory is set
-	return nil
+	return postOrQueue(c, fm, content)
+}
+
+// fileFrontMatter strips any front matter from the given file's content, and
+// returns the options in it, except for those given as flags.
+func fileFrontMatter(c *cli.Context, fm api.FrontMatter, content []byte) (api.FrontMatter, []byte) {
+	fileFM, content := api.ParseFrontMatter(content)
+	if fm.Blog == "" {
+		fm.Blog = fileFM.Blog
+	}
+	if fileFM.Font != "" && !c.IsSet("font") && !c.GlobalIsSet("font") && !c.Bool("code") {
+		fm.Font = fileFM.Font
+	}
+	if fm.Lang == "" {
+		fm.Lang = fileFM.Lang
+	}
+	fm.Tags = fileFM.Tags
+	return fm, content
 }
 
 func CmdDelete(c *cli.Context) error {
+	if c.Bool("all-anonymous") || c.String("blog") != "" || c.String("before") != "" ||
+		c.String("match") != "" || c.Bool("dry-run") || c.Args().First() == "-" {
+		return cmdDeleteMany(c)
+	}
+
 	friendlyID := c.Args().Get(0)
 	token := c.Args().Get(1)
 	if friendlyID == "" {
-		return cli.NewExitError("usage: "+executable.Name()+" delete <postId> [<token>]", 1)
+		return usageError("delete <postId> [<token>]")
 	}
 
-	u, _ := config.LoadUser(c)
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
 	if token == "" {
 		// Search for the token locally
-		token = api.TokenFromID(c, friendlyID)
-		if token == "" && u == nil {
-			log.Errorln("Couldn't find an edit token locally. Did you create this post here?")
-			log.ErrorlnQuit("If you have an edit token, use: "+executable.Name()+" delete %s <token>", friendlyID)
+		token = s.TokenFromID(friendlyID)
+		if token == "" && !s.LoggedIn() {
+			return cli.NewExitError(fmt.Sprintf("Couldn't find an edit token locally. Did you create this post here?\nIf you have an edit token, use: %s delete %s <token>", executable.Name(), friendlyID), ExitUsage)
 		}
 	}
 
+	if c.Bool("offline") {
+		return queueDelete(c, friendlyID, token, nil)
+	}
+
 	if config.IsTor(c) {
 		log.Info(c, "Deleting via hidden service...")
 	} else {
 		log.Info(c, "Deleting...")
 	}
 
-	err := api.DoDelete(c, friendlyID, token)
+	err = deletePost(c, s, friendlyID, token)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("Couldn't delete post: %v", err), 1)
+		if api.IsNetworkError(err) {
+			return queueDelete(c, friendlyID, token, err)
+		}
+		return exitErrorf(err, "Couldn't delete post: %v", err)
 	}
+	return nil
+}
 
-	// TODO: Delete local file, if necessary
+// cmdDeleteMany deletes every post selected by the filters given to delete,
+// and the posts with the IDs given as arguments, or read from stdin if the
+// only argument is "-". The posts are listed and must be confirmed first,
+// unless --yes is given.
+func cmdDeleteMany(c *cli.Context) error {
+	f := api.PostFilter{
+		IDs:       c.Args(),
+		Anonymous: c.Bool("all-anonymous"),
+		Blog:      c.String("blog"),
+	}
+	if c.Args().First() == "-" {
+		in, err := readStdIn()
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitError)
+		}
+		f.IDs = strings.Fields(string(in))
+		if len(f.IDs) == 0 {
+			return cli.NewExitError("No post IDs given on stdin.", ExitUsage)
+		}
+	}
+	if before := c.String("before"); before != "" {
+		var err error
+		f.Before, err = parseDate(before)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid --before %q. Give a date like 2006-01-02.", before), ExitUsage)
+		}
+	}
+	if match := c.String("match"); match != "" {
+		var err error
+		f.Match, err = regexp.Compile(match)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid --match: %v", err), ExitUsage)
+		}
+	}
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if config.IsTor(c) {
+		log.Info(c, "Finding posts via hidden service...")
+	} else {
+		log.Info(c, "Finding posts...")
+	}
+	posts, err := s.FilterPosts(f)
+	if err != nil {
+		return exitErrorf(err, "Couldn't find posts: %v", err)
+	}
+	if len(posts) == 0 {
+		fmt.Fprintln(os.Stderr, "No posts to delete.")
+		return nil
+	}
+
+	if c.Bool("dry-run") {
+		listPosts(os.Stdout, posts)
+		return nil
+	}
+	if !c.Bool("yes") {
+		listPosts(os.Stderr, posts)
+		ok, err := confirm(fmt.Sprintf("Delete %d post(s)?", len(posts)))
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("%v\nTo delete without asking, use --yes.", err), ExitUsage)
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "No posts deleted.")
+			return nil
+		}
+	}
+
+	var okCount, errCount int
+	code := ExitOK
+	for _, p := range posts {
+		status := fmt.Sprintf("Post %s...", p.ID)
+		err := deletePost(c, s, p.ID, s.TokenFromID(p.ID))
+		if err != nil {
+			log.Errorln("%serror: %v", status, err)
+			errCount++
+			code = combineExitCode(code, err)
+			continue
+		}
+		fmt.Printf("%sOK\n", status)
+		okCount++
+	}
+	fmt.Fprintf(os.Stderr, "%d deleted, %d failed\n", okCount, errCount)
+	if code != ExitOK {
+		return cli.NewExitError("", code)
+	}
+	return nil
+}
+
+// deletePost deletes the given post, along with the file it was pulled to, if
+// any.
+func deletePost(c *cli.Context, s *api.Session, friendlyID, token string) error {
+	file := s.PulledFile(friendlyID)
+	if err := s.Delete(friendlyID, token); err != nil {
+		return err
+	}
+	if file == "" {
+		return nil
+	}
+	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
+	if err != nil || cfg.Posts.Directory == "" {
+		return nil
+	}
+	err = os.Remove(filepath.Join(cfg.Posts.Directory, file))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn("Couldn't remove %s: %v", file, err)
+	} else if err == nil {
+		log.Info(c, "Removed %s", file)
+	}
+	return nil
+}
+
+// listPosts writes a table of the given posts, with when each was created,
+// its blog and its title.
+func listPosts(w io.Writer, posts []writeas.Post) {
+	tw := tabwriter.NewWriter(w, 10, 0, 2, ' ', 0)
+	for _, p := range posts {
+		blog := "-"
+		if p.Collection != nil {
+			blog = p.Collection.Alias
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.ID, p.Created.Local().Format("2006-01-02"), blog, api.PostTitle(&p))
+	}
+	tw.Flush()
+}
+
+// parseDate parses a date like 2006-01-02, in local time, or a full RFC 3339
+// timestamp.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// CmdGC deletes posts published with --expire that have expired, and reports
+// which ones it removed.
+func CmdGC(c *cli.Context) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	dryRun := c.Bool("dry-run")
+	if !dryRun {
+		if config.IsTor(c) {
+			log.Info(c, "Deleting expired posts via hidden service...")
+		} else {
+			log.Info(c, "Deleting expired posts...")
+		}
+	}
+
+	results, err := s.DeleteExpired(time.Now(), dryRun)
+	if err != nil {
+		return exitErrorf(err, "Couldn't delete expired posts: %v", err)
+	}
+	code := ExitOK
+	for _, r := range results {
+		expired := r.Post.Expires.Local().Format("2006-01-02 15:04")
+		switch {
+		case r.Skipped && dryRun:
+			fmt.Printf("Would delete %s, expired %s\n", r.Post.ID, expired)
+		case r.Skipped:
+			log.Info(c, "Skipping %s, published by %s", r.Post.ID, r.Post.User)
+		case r.Gone:
+			fmt.Printf("Forgot %s, already deleted\n", r.Post.ID)
+		case r.Err != nil:
+			log.Errorln("Couldn't delete %s: %v", r.Post.ID, r.Err)
+			code = combineExitCode(code, r.Err)
+		default:
+			fmt.Printf("Deleted %s, expired %s\n", r.Post.ID, expired)
+		}
+	}
+	if len(results) == 0 {
+		log.Info(c, "No posts have expired.")
+	}
+	if code != ExitOK {
+		return cli.NewExitError("", code)
+	}
 	return nil
 }
 
@@ -126,38 +422,81 @@ func CmdUpdate(c *cli.Context) error {
 	friendlyID := c.Args().Get(0)
 	token := c.Args().Get(1)
 	if friendlyID == "" {
-		return cli.NewExitError("usage: "+executable.Name()+" update <postId> [<token>]", 1)
+		return usageError("update <postId> [<token>]")
 	}
 
-	u, _ := config.LoadUser(c)
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
 	if token == "" {
 		// Search for the token locally
-		token = api.TokenFromID(c, friendlyID)
-		if token == "" && u == nil {
-			log.Errorln("Couldn't find an edit token locally. Did you create this post here?")
-			log.ErrorlnQuit("If you have an edit token, use: "+executable.Name()+" update %s <token>", friendlyID)
+		token = s.TokenFromID(friendlyID)
+		if token == "" && !s.LoggedIn() {
+			return cli.NewExitError(fmt.Sprintf("Couldn't find an edit token locally. Did you create this post here?\nIf you have an edit token, use: %s update %s <token>", executable.Name(), friendlyID), ExitUsage)
 		}
 	}
 
 	// Read post body
-	fullPost := api.ReadStdIn()
+	fullPost, err := readStdIn()
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	fm, fullPost := codePost(updateFrontMatter(c), fullPost, config.CodeLang(c))
+
+	preview := c.Bool("diff") || c.Bool("dry-run")
+	force := c.Bool("force")
+	if err := checkVersion(c, s, friendlyID); err != nil {
+		if api.KindOf(err) != api.KindConflict {
+			return exitError(err)
+		}
+		if !preview {
+			return exitErrorf(err, "%v\nTo review the differences before overwriting them, use --diff. To overwrite them anyway, use --force.", err)
+		}
+		// The preview shows what they changed, and asks before overwriting it
+		log.Warn("%v", err)
+		force = true
+	}
+
+	if preview {
+		ok, err := previewUpdate(c, s, friendlyID, fm, fullPost)
+		if err != nil {
+			return exitError(err)
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	if c.Bool("offline") {
+		return queueUpdate(c, fm, fullPost, friendlyID, token, force, nil)
+	}
 
 	if config.IsTor(c) {
 		log.Info(c, "Updating via hidden service...")
 	} else {
 		log.Info(c, "Updating...")
 	}
-	err := api.DoUpdate(c, fullPost, friendlyID, token, c.String("font"), c.Bool("code"))
+	_, err = s.Update(friendlyID, token, fm.PostParams(fullPost))
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("%v", err), 1)
+		if api.IsNetworkError(err) {
+			return queueUpdate(c, fm, fullPost, friendlyID, token, force, err)
+		}
+		return exitError(err)
 	}
 	return nil
 }
 
 func CmdGet(c *cli.Context) error {
-	friendlyID := c.Args().Get(0)
-	if friendlyID == "" {
-		return cli.NewExitError("usage: "+executable.Name()+" get <postId>", 1)
+	if c.Args().Get(0) == "" {
+		return usageError("get <postId|blog/slug|URL>")
+	}
+	ref, err := api.ParsePostRef(c.Args().Get(0))
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitUsage)
+	}
+	if err := checkPostFormat(c.String("format")); err != nil {
+		return cli.NewExitError(err.Error(), ExitUsage)
 	}
 
 	if config.IsTor(c) {
@@ -166,10 +505,33 @@ func CmdGet(c *cli.Context) error {
 		log.Info(c, "Getting...")
 	}
 
-	err := api.DoFetch(c, friendlyID)
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	p, err := s.GetPostRef(ref)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if c.Bool("decrypt") {
+		if err := decryptPost(c, p); err != nil {
+			return exitError(err)
+		}
+	}
+
+	out, err := formatPost(p, c.String("format"))
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("%v", err), 1)
+		return cli.NewExitError(err.Error(), ExitError)
 	}
+	if fname := c.String("output"); fname != "" {
+		if err := ioutil.WriteFile(fname, out, 0644); err != nil {
+			return cli.NewExitError(fmt.Sprintf("Error writing post: %s", err), ExitError)
+		}
+		log.Info(c, "Saved post to %s", fname)
+		return nil
+	}
+	os.Stdout.Write(out)
 	return nil
 }
 
@@ -177,12 +539,16 @@ func CmdAdd(c *cli.Context) error {
 	friendlyID := c.Args().Get(0)
 	token := c.Args().Get(1)
 	if friendlyID == "" || token == "" {
-		return cli.NewExitError("usage: "+executable.Name()+" add <postId> <token>", 1)
+		return usageError("add <postId> <token>")
 	}
 
-	err := api.AddPost(c, friendlyID, token)
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	err = s.AddLocalPost(friendlyID, token)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("%v", err), 1)
+		return exitError(err)
 	}
 	return nil
 }
@@ -192,18 +558,24 @@ func CmdListPosts(c *cli.Context) error {
 	ids := c.Bool("id")
 	details := c.Bool("v")
 
-	posts := api.GetPosts(c)
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if tag := c.String("tag"); tag != "" {
+		return listTaggedPosts(c, s, tag)
+	}
+	posts := s.LocalPosts()
 
-	u, _ := config.LoadUser(c)
-	if u != nil {
+	if s.LoggedIn() {
 		if config.IsTor(c) {
 			log.Info(c, "Getting posts via hidden service...")
 		} else {
 			log.Info(c, "Getting posts...")
 		}
-		remotePosts, err := api.GetUserPosts(c, true)
+		remotePosts, err := s.RemotePosts(true)
 		if err != nil {
-			return cli.NewExitError(fmt.Sprintf("error getting posts: %v", err), 1)
+			return exitErrorf(err, "error getting posts: %v", err)
 		}
 
 		if len(remotePosts) > 0 {
@@ -229,7 +601,7 @@ func CmdListPosts(c *cli.Context) error {
 			fmt.Println(identifier)
 		}
 
-		if len(*posts) > 0 {
+		if len(posts) > 0 {
 			fmt.Printf("\nUnclaimed Posts\n")
 		}
 	}
@@ -237,7 +609,7 @@ func CmdListPosts(c *cli.Context) error {
 	if details {
 		var p api.Post
 		tw := tabwriter.NewWriter(os.Stdout, 10, 0, 2, ' ', tabwriter.TabIndent)
-		numPosts := len(*posts)
+		numPosts := len(posts)
 		if ids || !urls && numPosts != 0 {
 			fmt.Fprintf(tw, "%s\t%s\t\n", "ID", "Token")
 		} else if numPosts != 0 {
@@ -245,8 +617,8 @@ func CmdListPosts(c *cli.Context) error {
 		} else {
 			fmt.Fprintf(tw, "No local posts found\n")
 		}
-		for i := range *posts {
-			p = (*posts)[numPosts-1-i]
+		for i := range posts {
+			p = posts[numPosts-1-i]
 			if ids || !urls {
 				fmt.Fprintf(tw, "%s\t%s\t\n", p.ID, p.EditToken)
 			} else {
@@ -256,7 +628,7 @@ func CmdListPosts(c *cli.Context) error {
 		return tw.Flush()
 	}
 
-	for _, p := range *posts {
+	for _, p := range posts {
 		if ids || !urls {
 			fmt.Printf("%s\n", p.ID)
 		} else {
@@ -266,6 +638,61 @@ func CmdListPosts(c *cli.Context) error {
 	return nil
 }
 
+// listTaggedPosts lists the user's posts, on any blog or none, and the
+// anonymous posts stored here, that have the given hashtag.
+func listTaggedPosts(c *cli.Context, s *api.Session, tag string) error {
+	if config.IsTor(c) {
+		log.Info(c, "Getting posts via hidden service...")
+	} else {
+		log.Info(c, "Getting posts...")
+	}
+	posts, err := s.FilterPosts(api.PostFilter{Tags: []string{strings.ToLower(strings.TrimLeft(tag, "#"))}})
+	if err != nil {
+		return exitErrorf(err, "error getting posts: %v", err)
+	}
+	if c.Bool("v") {
+		listPosts(os.Stdout, posts)
+		return nil
+	}
+	for i := range posts {
+		if c.Bool("url") && !c.Bool("id") {
+			fmt.Println(s.PostURL(&posts[i]))
+		} else {
+			fmt.Println(posts[i].ID)
+		}
+	}
+	return nil
+}
+
+// CmdTags lists the hashtags in the user's posts, with how many posts have
+// each, most used first.
+func CmdTags(c *cli.Context) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if config.IsTor(c) {
+		log.Info(c, "Getting posts via hidden service...")
+	} else {
+		log.Info(c, "Getting posts...")
+	}
+	posts, err := s.FilterPosts(api.PostFilter{Blog: c.String("blog")})
+	if err != nil {
+		return exitErrorf(err, "error getting posts: %v", err)
+	}
+
+	tags := api.CountTags(posts)
+	if len(tags) == 0 {
+		fmt.Fprintln(os.Stderr, "No tags found.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 10, 0, 2, ' ', 0)
+	for _, t := range tags {
+		fmt.Fprintf(tw, "%s\t%d\n", t.Tag, t.Count)
+	}
+	return tw.Flush()
+}
+
 func getPostURL(c *cli.Context, slug string) string {
 	var base string
 	if c.App.Name == "writeas" {
@@ -275,7 +702,7 @@ func getPostURL(c *cli.Context, slug string) string {
 			base = config.WriteasBaseURL
 		}
 	} else {
-		if host := api.HostURL(c); host != "" {
+		if host := config.HostURL(c); host != "" {
 			base = host
 		} else {
 			// TODO handle error, or load config globally, see T601
@@ -301,19 +728,23 @@ func getPostURL(c *cli.Context, slug string) string {
 func CmdCollections(c *cli.Context) error {
 	u, err := config.LoadUser(c)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("couldn't load config: %v", err), 1)
+		return exitErrorf(err, "couldn't load config: %v", err)
 	}
 	if u == nil {
-		return cli.NewExitError("You must be authenticated to view collections.\nLog in first with: "+executable.Name()+" auth <username>", 1)
+		return cli.NewExitError("You must be authenticated to view collections.\nLog in first with: "+executable.Name()+" auth <username>", ExitNotLoggedIn)
 	}
 	if config.IsTor(c) {
 		log.Info(c, "Getting blogs via hidden service...")
 	} else {
 		log.Info(c, "Getting blogs...")
 	}
-	colls, err := api.DoFetchCollections(c)
+	s, err := newUserSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	colls, err := s.Collections()
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("Couldn't get collections for user %s: %v", u.User.Username, err), 1)
+		return exitErrorf(err, "Couldn't get collections for user %s: %v", u.User.Username, err)
 	}
 	urls := c.Bool("url")
 	tw := tabwriter.NewWriter(os.Stdout, 8, 0, 2, ' ', tabwriter.TabIndent)
@@ -336,30 +767,34 @@ func CmdCollections(c *cli.Context) error {
 func CmdClaim(c *cli.Context) error {
 	u, err := config.LoadUser(c)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("couldn't load config: %v", err), 1)
+		return exitErrorf(err, "couldn't load config: %v", err)
 	}
 	if u == nil {
-		return cli.NewExitError("You must be authenticated to claim local posts.\nLog in first with: "+executable.Name()+" auth <username>", 1)
+		return cli.NewExitError("You must be authenticated to claim local posts.\nLog in first with: "+executable.Name()+" auth <username>", ExitNotLoggedIn)
 	}
 
-	localPosts := api.GetPosts(c)
-	if len(*localPosts) == 0 {
+	s, err := newUserSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	localPosts := s.LocalPosts()
+	if len(localPosts) == 0 {
 		return nil
 	}
 
 	if config.IsTor(c) {
-		log.Info(c, "Claiming %d post(s) for %s via hidden service...", len(*localPosts), u.User.Username)
+		log.Info(c, "Claiming %d post(s) for %s via hidden service...", len(localPosts), u.User.Username)
 	} else {
-		log.Info(c, "Claiming %d post(s) for %s...", len(*localPosts), u.User.Username)
+		log.Info(c, "Claiming %d post(s) for %s...", len(localPosts), u.User.Username)
 	}
 
-	results, err := api.ClaimPosts(c, localPosts)
+	results, err := s.Claim(localPosts)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("Failed to claim posts: %v", err), 1)
+		return exitErrorf(err, "Failed to claim posts: %v", err)
 	}
 
 	var okCount, errCount int
-	for _, r := range *results {
+	for _, r := range results {
 		id := r.ID
 		if id == "" {
 			// No top-level ID, so the claim was successful
@@ -372,8 +807,6 @@ func CmdClaim(c *cli.Context) error {
 		} else {
 			log.Info(c, "%sOK", status)
 			okCount++
-			// only delete local if successful
-			api.RemovePost(c, id)
 		}
 	}
 	log.Info(c, "%d claimed, %d failed", okCount, errCount)
@@ -388,23 +821,23 @@ func CmdAuth(c *cli.Context) error {
 	// Check configuration
 	u, err := config.LoadUser(c)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("couldn't load config: %v", err), 1)
+		return exitErrorf(err, "couldn't load config: %v", err)
 	}
 	if u != nil && u.AccessToken != "" && username == u.User.Username {
-		return cli.NewExitError("You're already authenticated as "+u.User.Username, 1)
+		return cli.NewExitError("You're already authenticated as "+u.User.Username, ExitUsage)
 	}
 
 	// Validate arguments and get password
 	if username == "" {
 		cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
 		if err != nil {
-			return cli.NewExitError(fmt.Sprintf("Failed to load config: %v", err), 1)
+			return exitErrorf(err, "Failed to load config: %v", err)
 		}
 		if cfg.Default.Host != "" && cfg.Default.User != "" {
 			username = cfg.Default.User
 			fmt.Printf("No user provided, using default user %s for host %s...\n", cfg.Default.User, cfg.Default.Host)
 		} else {
-			return cli.NewExitError("usage: "+executable.Name()+" auth <username>", 1)
+			return usageError("auth <username>")
 		}
 	}
 
@@ -414,12 +847,12 @@ func CmdAuth(c *cli.Context) error {
 		fmt.Print("Password: ")
 		enteredPass, err := gopass.GetPasswdMasked()
 		if err != nil {
-			return cli.NewExitError(fmt.Sprintf("error reading password: %v", err), 1)
+			return exitErrorf(err, "error reading password: %v", err)
 		}
 
 		// Validate password
 		if len(enteredPass) == 0 {
-			return cli.NewExitError("Please enter your password.", 1)
+			return cli.NewExitError("Please enter your password.", ExitUsage)
 		}
 		pass = string(enteredPass)
 	}
@@ -429,10 +862,19 @@ func CmdAuth(c *cli.Context) error {
 	} else {
 		log.Info(c, "Logging in...")
 	}
-	err = api.DoLogIn(c, username, pass)
+	s, err := newSession(c)
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("error logging in: %v", err), 1)
+		return exitErrorf(err, "error logging in: %v", err)
 	}
+	u, err = s.LogIn(username, pass)
+	if err != nil {
+		return exitErrorf(err, "error logging in: %v", err)
+	}
+	err = config.SaveUser(c, u)
+	if err != nil {
+		return exitErrorf(err, "error logging in: %v", err)
+	}
+	log.Info(c, "Logged in as %s.\n", u.User.Username)
 
 	return nil
 }
@@ -443,9 +885,16 @@ func CmdLogOut(c *cli.Context) error {
 	} else {
 		log.Info(c, "Logging out...")
 	}
-	err := api.DoLogOut(c)
+	s, err := newUserSession(c)
+	if err == nil {
+		err = s.LogOut()
+	}
+	if err == nil {
+		// delete local user file
+		err = config.DeleteUser(c)
+	}
 	if err != nil {
-		return cli.NewExitError(fmt.Sprintf("error logging out: %v", err), 1)
+		return exitErrorf(err, "error logging out: %v", err)
 	}
 	return nil
 }
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/log"
+	"golang.org/x/term"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// encryptRequested returns whether the post should be encrypted, either with
+// --encrypt or by giving a --recipient.
+func encryptRequested(c *cli.Context) bool {
+	return c.Bool("encrypt") || len(c.StringSlice("recipient")) > 0
+}
+
+// encryptPost encrypts the given post to the age public keys or the keys in
+// the files given with --recipient or, without any, with a passphrase.
+func encryptPost(c *cli.Context, post []byte) ([]byte, error) {
+	recipients := &api.Keys{}
+	for _, r := range c.StringSlice("recipient") {
+		keys, err := api.ReadRecipient(r)
+		if err != nil {
+			return nil, err
+		}
+		recipients.Add(keys)
+	}
+
+	var pass []byte
+	if len(recipients.PGP) == 0 && len(recipients.AgeRecipients) == 0 {
+		var err error
+		pass, err = readPassphrase("Passphrase to encrypt post: ", true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Info(c, "Encrypting...")
+	return api.EncryptPost(post, recipients, pass)
+}
+
+// decryptPost replaces the given post's title and content with what's
+// encrypted in it, using the secret key or age identity in the --key file if
+// there is one. Posts that aren't encrypted are left as they are.
+func decryptPost(c *cli.Context, p *writeas.Post) error {
+	if !api.IsEncrypted(p.Content) {
+		log.Info(c, "Post isn't encrypted.")
+		return nil
+	}
+	var keys *api.Keys
+	if fname := c.String("key"); fname != "" {
+		var err error
+		keys, err = api.ReadKeyFile(fname)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info(c, "Decrypting...")
+	text, err := api.DecryptPost([]byte(p.Content), keys, func() ([]byte, error) {
+		return readPassphrase("Passphrase to decrypt post: ", false)
+	})
+	if err != nil {
+		return err
+	}
+	p.Title, p.Content = posts.ExtractTitle(string(text))
+	return nil
+}
+
+// readPassphrase returns the passphrase in the WRITEAS_PASSPHRASE environment
+// variable, or asks for one on the terminal, without echoing it. When
+// confirming, it's asked for twice, to catch typos.
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if pass := os.Getenv("WRITEAS_PASSPHRASE"); pass != "" {
+		return []byte(pass), nil
+	}
+	tty, err := openTTY()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open terminal to ask for passphrase: %v\nSet it in WRITEAS_PASSPHRASE instead.", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading passphrase: %v", err)
+	}
+	if len(pass) == 0 {
+		return nil, cli.NewExitError("Please enter a passphrase.", ExitUsage)
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Again, to confirm: ")
+		again, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading passphrase: %v", err)
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, cli.NewExitError("Passphrases don't match.", ExitUsage)
+		}
+	}
+	return pass, nil
+}
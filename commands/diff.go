@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/log"
+	"golang.org/x/term"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// ANSI colours for diff output
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// postText returns a post's title and body as a single text, the way it's
+// written when publishing.
+func postText(title, content string) []byte {
+	text := content
+	if title != "" {
+		text = "# " + title + "\n\n" + text
+	}
+	if len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return []byte(text)
+}
+
+// textDiff returns a unified diff between two versions of a post, or an
+// empty string if they're the same.
+func textDiff(before, after []byte, name string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: name + " (current)",
+		ToFile:   name + " (edited)",
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+// printDiff writes the given diff to stdout, in colour if stdout is a
+// terminal and NO_COLOR isn't set.
+func printDiff(diff string) {
+	if !useColor() {
+		fmt.Print(diff)
+		return
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		color := ""
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			color = colorBold
+		case strings.HasPrefix(line, "@@"):
+			color = colorCyan
+		case strings.HasPrefix(line, "-"):
+			color = colorRed
+		case strings.HasPrefix(line, "+"):
+			color = colorGreen
+		}
+		if color == "" {
+			fmt.Print(line)
+			continue
+		}
+		fmt.Print(color + strings.TrimSuffix(line, "\n") + colorReset)
+		if strings.HasSuffix(line, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+func useColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// previewUpdate shows how the given update would change the post. It returns
+// whether the update should go ahead: never on a dry run, and otherwise only
+// if something changed and the user confirms it.
+func previewUpdate(c *cli.Context, s *api.Session, friendlyID string, fm api.FrontMatter, post []byte) (bool, error) {
+	if config.IsTor(c) {
+		log.Info(c, "Getting current version via hidden service...")
+	} else {
+		log.Info(c, "Getting current version...")
+	}
+	p, err := s.GetPost(friendlyID)
+	if err != nil {
+		return false, err
+	}
+
+	// Only options being changed are compared
+	var before, after []byte
+	if fm.Font != "" {
+		before = append(before, "font: "+p.Font+"\n"...)
+		after = append(after, "font: "+fm.Font+"\n"...)
+	}
+	if fm.Lang != "" {
+		lang := ""
+		if p.Language != nil {
+			lang = *p.Language
+		}
+		before = append(before, "lang: "+lang+"\n"...)
+		after = append(after, "lang: "+fm.Lang+"\n"...)
+	}
+	pp := fm.PostParams(post)
+	before = append(before, postText(p.Title, p.Content)...)
+	after = append(after, postText(pp.Title, pp.Content)...)
+
+	diff := textDiff(before, after, friendlyID)
+	if diff == "" {
+		log.Errorln("No changes.")
+		return false, nil
+	}
+	printDiff(diff)
+	if c.Bool("dry-run") {
+		return false, nil
+	}
+	if c.Bool("yes") {
+		return true, nil
+	}
+	ok, err := confirm("Update " + friendlyID + "?")
+	if err != nil {
+		return false, fmt.Errorf("%v\nTo update without asking, use --yes.", err)
+	}
+	return ok, nil
+}
+
+// confirm asks the user a yes or no question on the terminal, even if stdin
+// is redirected, and returns whether they answered yes.
+func confirm(question string) (bool, error) {
+	tty, err := openTTY()
+	if err != nil {
+		return false, fmt.Errorf("Couldn't open terminal to ask for confirmation: %v", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("Couldn't read answer: %v", err)
+	}
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y"), nil
+}
+
+// openTTY opens the terminal for reading, so the user can be asked questions
+// while stdin is used for something else.
+func openTTY() (*os.File, error) {
+	ttyName := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		ttyName = "CONIN$"
+	}
+	return os.Open(ttyName)
+}
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/log"
+	"golang.org/x/term"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// resumeDraft returns the most recently changed draft if the user wants to
+// resume it, or nil to start a new one. Unless --resume or --no-resume says
+// which, the user is asked, but only if stdin is a terminal; otherwise a new
+// draft is started. The question goes to stderr, so it isn't mixed up with
+// the post URL written to stdout.
+func resumeDraft(c *cli.Context, s *api.Session) (*api.Draft, error) {
+	if c.Bool("no-resume") {
+		return nil, nil
+	}
+	drafts, err := s.Drafts()
+	if err != nil || len(drafts) == 0 {
+		return nil, err
+	}
+	d := drafts[0]
+	if c.Bool("resume") {
+		return &d, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Info(c, "Starting a new draft. To resume draft %s instead, use --resume.", d.ID)
+		return nil, nil
+	}
+	ok, err := confirm(fmt.Sprintf("Resume unfinished draft %s (\"%s\", %s)?", d.ID, d.Summary(), d.Modified.Local().Format("2006-01-02 15:04")))
+	if err != nil {
+		return nil, fmt.Errorf("%v\nTo choose without asking, use --resume or --no-resume.", err)
+	}
+	if ok {
+		return &d, nil
+	}
+	return nil, nil
+}
+
+// publishDraft publishes the given draft, or saves it to the outbox, and
+// removes the draft once it's been sent or queued.
+func publishDraft(c *cli.Context, s *api.Session, d *api.Draft) error {
+	if len(bytes.TrimSpace(d.Body)) == 0 {
+		return &api.Error{Kind: api.KindValidation, Msg: "Draft " + d.ID + " is empty."}
+	}
+	fm, body := codePost(d.FrontMatter, d.Body, config.CodeLang(c))
+	err := postOrQueue(c, fm, body)
+	var qe *queuedError
+	if err != nil && !errors.As(err, &qe) {
+		return err
+	}
+	if rmErr := s.DeleteDraft(d.ID); rmErr != nil {
+		log.Warn("Couldn't remove draft %s: %v", d.ID, rmErr)
+	}
+	return err
+}
+
+// draftSavedMessage tells the user how to get back to an unpublished draft.
+func draftSavedMessage(id string) string {
+	return fmt.Sprintf("Your draft is saved as %s. Edit it with: %s drafts edit %[1]s\nor publish it with: %[2]s drafts publish %[1]s", id, executable.Name())
+}
+
+func CmdDrafts(c *cli.Context) error {
+	switch c.Args().First() {
+	case "list", "":
+		return cmdDraftsList(c)
+	case "edit":
+		return cmdDraftsEdit(c, c.Args().Get(1))
+	case "publish":
+		return cmdDraftsPublish(c, c.Args().Tail())
+	case "rm":
+		return cmdDraftsRemove(c, c.Args().Tail())
+	}
+	return usageError("drafts list|edit|publish|rm [<id>...]")
+}
+
+func cmdDraftsList(c *cli.Context) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	drafts, err := s.Drafts()
+	if err != nil {
+		return exitErrorf(err, "Couldn't read drafts: %v", err)
+	}
+	if len(drafts) == 0 {
+		log.Info(c, "No drafts.")
+		return nil
+	}
+
+	details := c.Bool("v") || c.Bool("verbose")
+	tw := tabwriter.NewWriter(os.Stdout, 10, 0, 2, ' ', tabwriter.TabIndent)
+	if details {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", "ID", "Modified", "Blog", "Draft", "File")
+	} else {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", "ID", "Modified", "Blog", "Draft")
+	}
+	for _, d := range drafts {
+		modified := d.Modified.Local().Format("2006-01-02 15:04")
+		if details {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", d.ID, modified, d.Blog, d.Summary(), d.Path)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", d.ID, modified, d.Blog, d.Summary())
+		}
+	}
+	return tw.Flush()
+}
+
+func cmdDraftsEdit(c *cli.Context, id string) error {
+	if id == "" {
+		return usageError("drafts edit <id>")
+	}
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	d, err := s.Draft(id)
+	if err != nil {
+		return exitError(err)
+	}
+	if err := editPost(c, d.Path); err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	log.Info(c, "Saved draft %s", d.ID)
+	return nil
+}
+
+func cmdDraftsPublish(c *cli.Context, ids []string) error {
+	if len(ids) == 0 {
+		return usageError("drafts publish <id>...")
+	}
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if config.IsTor(c) {
+		log.Info(c, "Publishing via hidden service...")
+	} else {
+		log.Info(c, "Publishing...")
+	}
+	code := ExitOK
+	for _, id := range ids {
+		d, err := s.Draft(id)
+		if err == nil {
+			err = publishDraft(c, s, d)
+		}
+		if err != nil {
+			log.Errorln("%s: %v", id, err)
+			code = combineExitCode(code, err)
+		}
+	}
+	if code != ExitOK {
+		return cli.NewExitError("", code)
+	}
+	return nil
+}
+
+func cmdDraftsRemove(c *cli.Context, ids []string) error {
+	if len(ids) == 0 {
+		return usageError("drafts rm <id>...")
+	}
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	for _, id := range ids {
+		if err := s.DeleteDraft(id); err != nil {
+			return exitErrorf(err, "Couldn't remove %s: %v", id, err)
+		}
+		log.Info(c, "Removed %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/fileutils"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// editableText returns the given post as it's shown in the editor: its
+// options as front matter, followed by its title and body.
+func editableText(p *writeas.Post) (api.FrontMatter, []byte) {
+	fm := api.FrontMatter{Font: p.Font}
+	if p.Collection != nil {
+		fm.Blog = p.Collection.Alias
+	}
+	if p.Language != nil {
+		fm.Lang = *p.Language
+	}
+	return fm, fm.Marshal(postText(p.Title, p.Content))
+}
+
+func CmdEdit(c *cli.Context) error {
+	friendlyID := c.Args().Get(0)
+	if friendlyID == "" {
+		return usageError("edit [-b <blog>] <postId|slug>")
+	}
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+
+	if config.IsTor(c) {
+		log.Info(c, "Getting via hidden service...")
+	} else {
+		log.Info(c, "Getting...")
+	}
+	var p *writeas.Post
+	if blog := config.Collection(c); blog != "" {
+		p, err = s.GetCollectionPost(blog, friendlyID)
+	} else {
+		p, err = s.GetPost(friendlyID)
+	}
+	if err != nil {
+		return exitError(err)
+	}
+	return editRemotePost(c, s, p)
+}
+
+// editRemotePost opens the given post, just fetched, in the user's editor,
+// then updates it with any changes, or queues the update if it can't be sent.
+func editRemotePost(c *cli.Context, s *api.Session, p *writeas.Post) error {
+	token := s.TokenFromID(p.ID)
+	if token == "" && !s.LoggedIn() {
+		return cli.NewExitError(fmt.Sprintf("Couldn't find an edit token locally. Did you create this post here?\nIf you have an edit token, use: %s update %s <token>", executable.Name(), p.ID), ExitUsage)
+	}
+
+	orig, text := editableText(p)
+	f, err := fileutils.TempFile(os.TempDir(), "WApost", strings.TrimPrefix(config.EditorExt(p.Font, false), "."))
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Error creating temp file: %s", err), ExitError)
+	}
+	_, err = f.Write(text)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return cli.NewExitError(fmt.Sprintf("Error writing temp file: %s", err), ExitError)
+	}
+
+	if err := editPost(c, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		return cli.NewExitError(fmt.Sprintf("Error reading post: %s", err), ExitError)
+	}
+
+	diff := textDiff(text, edited, p.ID)
+	if diff == "" {
+		os.Remove(f.Name())
+		log.Errorln("No changes.")
+		return nil
+	}
+	printDiff(diff)
+
+	fm, body := api.ParseFrontMatter(edited)
+	if len(bytes.TrimSpace(body)) == 0 {
+		os.Remove(f.Name())
+		return cli.NewExitError(fmt.Sprintf("Post is empty, so it wasn't updated. To delete it, use: %s delete %s", executable.Name(), p.ID), ExitInvalid)
+	}
+	if fm.Blog != orig.Blog {
+		log.Warn("Moving a post to another blog isn't supported, so the blog wasn't changed.")
+	}
+	// Only send the options that changed
+	changes := api.FrontMatter{}
+	if fm.Font != orig.Font {
+		changes.Font = fm.Font
+	}
+	if fm.Lang != orig.Lang {
+		changes.Lang = fm.Lang
+	}
+	changes.Tags = fm.Tags
+
+	force := c.Bool("force")
+	if err := checkVersion(c, s, p.ID); err != nil {
+		var ce *api.ConflictError
+		if !errors.As(err, &ce) {
+			return exitErrorf(err, "%v\nYour changes are saved in %s", err, f.Name())
+		}
+		log.Warn("%v", err)
+		_, current := editableText(ce.Current)
+		printDiff(textDiff(current, edited, p.ID))
+		if ok, _ := confirm("Overwrite the post with your version?"); !ok {
+			return exitErrorf(err, "Post wasn't updated. Your changes are saved in %s", f.Name())
+		}
+		force = true
+	}
+
+	if c.Bool("offline") {
+		os.Remove(f.Name())
+		return queueUpdate(c, changes, body, p.ID, token, force, nil)
+	}
+
+	if config.IsTor(c) {
+		log.Info(c, "Updating via hidden service...")
+	} else {
+		log.Info(c, "Updating...")
+	}
+	_, err = s.Update(p.ID, token, changes.PostParams(body))
+	if err != nil {
+		if api.IsNetworkError(err) {
+			os.Remove(f.Name())
+			return queueUpdate(c, changes, body, p.ID, token, force, err)
+		}
+		return exitErrorf(err, "%v\nYour changes are saved in %s", err, f.Name())
+	}
+	os.Remove(f.Name())
+	return nil
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/executable"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Exit codes. These are documented in the guides, so scripts can depend on
+// them; don't change existing values.
+const (
+	ExitOK = 0
+	// ExitError is for any failure not covered below.
+	ExitError = 1
+	// ExitUsage means the command was given bad arguments.
+	ExitUsage = 2
+	// ExitNotLoggedIn means the command needs an authenticated user.
+	ExitNotLoggedIn = 3
+	// ExitNotFound means the post, blog or user doesn't exist.
+	ExitNotFound = 4
+	// ExitBadToken means an edit token, access token or password was
+	// rejected.
+	ExitBadToken = 5
+	// ExitNetwork means the server couldn't be reached. Anything that could
+	// be saved to the outbox was.
+	ExitNetwork = 6
+	// ExitInvalid means the server rejected the request as invalid.
+	ExitInvalid = 7
+	// ExitConflict means the post was changed on the server since it was
+	// fetched, so it wasn't overwritten.
+	ExitConflict = 8
+)
+
+// ExitCode returns the exit code for the given error.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if ec, ok := err.(cli.ExitCoder); ok {
+		return ec.ExitCode()
+	}
+	switch api.KindOf(err) {
+	case api.KindNotLoggedIn:
+		return ExitNotLoggedIn
+	case api.KindNotFound:
+		return ExitNotFound
+	case api.KindBadToken:
+		return ExitBadToken
+	case api.KindNetwork:
+		return ExitNetwork
+	case api.KindValidation:
+		return ExitInvalid
+	case api.KindConflict:
+		return ExitConflict
+	}
+	return ExitError
+}
+
+// combineExitCode returns the exit code for a command that processes many
+// items, given the code for the failures so far and another failure: the
+// failures' code if they all have the same one, or else ExitError.
+func combineExitCode(code int, err error) int {
+	if code == ExitOK {
+		return ExitCode(err)
+	}
+	if code != ExitCode(err) {
+		return ExitError
+	}
+	return code
+}
+
+// exitError returns an error that makes the app print err's message and exit
+// with the code for its kind.
+func exitError(err error) error {
+	return cli.NewExitError(err.Error(), ExitCode(err))
+}
+
+// exitErrorf is like exitError, but formats the message itself. The exit code
+// still comes from err.
+func exitErrorf(err error, format string, a ...interface{}) error {
+	return cli.NewExitError(fmt.Sprintf(format, a...), ExitCode(err))
+}
+
+// usageError returns an error that shows how to use a command, given its
+// arguments, and exits with ExitUsage.
+func usageError(usage string) error {
+	return cli.NewExitError("usage: "+executable.Name()+" "+usage, ExitUsage)
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	stripmd "github.com/writeas/go-strip-markdown/v2"
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/web-core/posts"
+	"github.com/writeas/writeas-cli/config"
+)
+
+// postFormats are the formats a post can be output in by get.
+var postFormats = []string{"raw", "md", "html", "json", "txt"}
+
+// formatPost returns the given post in one of postFormats, or raw if format
+// is empty:
+//
+//	raw   the post as it was written
+//	md    the post as Markdown, with its blog, font and language as front matter
+//	html  a web page with the post rendered as it would be on the web
+//	json  the post as returned by the API
+//	txt   plain text, with any Markdown stripped
+func formatPost(p *writeas.Post, format string) ([]byte, error) {
+	switch format {
+	case "", "raw":
+		return postText(p.Title, p.Content), nil
+	case "md":
+		_, text := editableText(p)
+		return text, nil
+	case "html":
+		return postHTML(p), nil
+	case "json":
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "txt":
+		if !config.IsMarkdownFont(p.Font) {
+			return postText(p.Title, p.Content), nil
+		}
+		text := stripmd.Strip(p.Content)
+		if p.Title != "" {
+			text = stripmd.Strip(p.Title) + "\n\n" + text
+		}
+		return []byte(strings.TrimRight(text, "\n") + "\n"), nil
+	}
+	return nil, errUnknownFormat(format)
+}
+
+// checkPostFormat returns an error if format isn't one of postFormats.
+func checkPostFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range postFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return errUnknownFormat(format)
+}
+
+func errUnknownFormat(format string) error {
+	return fmt.Errorf("Unknown format %q. Use one of: %s.", format, strings.Join(postFormats, ", "))
+}
+
+// postHTML returns a standalone web page for the given post. Markdown is
+// rendered the same way WriteFreely does; other fonts are shown preformatted.
+func postHTML(p *writeas.Post) []byte {
+	var b bytes.Buffer
+	lang := ""
+	if p.Language != nil && *p.Language != "" {
+		lang = fmt.Sprintf(" lang=\"%s\"", html.EscapeString(*p.Language))
+	}
+	title := p.Title
+	if title == "" {
+		title = posts.FriendlyPostTitle(p.Content, p.ID)
+	}
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html%s>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<article>\n", lang, html.EscapeString(title))
+	if p.Title != "" {
+		fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(p.Title))
+	}
+	if config.IsMarkdownFont(p.Font) {
+		b.WriteString(posts.ApplyMarkdown([]byte(p.Content)))
+	} else {
+		fmt.Fprintf(&b, "<pre>%s</pre>\n", html.EscapeString(p.Content))
+	}
+	b.WriteString("</article>\n</body>\n</html>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// InitLogging configures logging from the app's global flags. It's meant to
+// be used as the app's Before function, along with CloseLogging as its After
+// function.
+func InitLogging(c *cli.Context) error {
+	opts := log.Options{Level: log.LevelWarn, FileLevel: log.LevelInfo}
+	if l := c.String("log-level"); l != "" {
+		level, err := log.ParseLevel(l)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitUsage)
+		}
+		opts.Level, opts.FileLevel = level, level
+	}
+	if c.Bool("debug") {
+		opts.Level, opts.FileLevel = log.LevelDebug, log.LevelDebug
+	}
+	opts.File = c.String("log-file")
+	switch f := c.String("log-format"); f {
+	case "", "text":
+	case "json":
+		opts.JSON = true
+	default:
+		return cli.NewExitError("Unknown log format "+f+". Use text or json.", ExitUsage)
+	}
+
+	if err := log.Init(opts); err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	return nil
+}
+
+// CloseLogging closes the log file, if any.
+func CloseLogging(c *cli.Context) error {
+	return log.Close()
+}
+
+// traceRequest logs an API request at the debug level.
+func traceRequest(t api.RequestTrace) {
+	kv := []interface{}{
+		"method", t.Method,
+		"url", t.URL,
+		"status", t.Status,
+		"duration", t.Duration.Round(time.Millisecond),
+	}
+	if t.Err != nil {
+		kv = append(kv, "error", t.Err)
+	}
+	log.Log(log.LevelDebug, "API request", kv...)
+}
@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// queuedError is returned when a request couldn't be sent, but was saved to
+// the outbox so it can be retried later.
+type queuedError struct {
+	entry *api.OutboxEntry
+	err   error
+}
+
+func (e *queuedError) Unwrap() error {
+	return e.err
+}
+
+func (e *queuedError) Error() string {
+	return fmt.Sprintf("%v\nSaved to outbox as %s. Send it later with: %s outbox flush", e.err, e.entry.ID, executable.Name())
+}
+
+// postOrQueue publishes the given post with the given options, or saves it to
+// the outbox if the --offline flag was given or the server couldn't be
+// reached. With --encrypt, only the encrypted post is sent or saved.
+func postOrQueue(c *cli.Context, fm api.FrontMatter, p []byte) error {
+	expires, err := expireTime(c)
+	if err != nil {
+		return err
+	}
+	if encryptRequested(c) {
+		p, err = encryptPost(c, p)
+		if err != nil {
+			return err
+		}
+		// Armor only reads properly in a monospace font
+		fm.Font = string(config.PostFontMono)
+	}
+
+	var postErr error
+	if c.Bool("offline") {
+		// Posts are only sent as a logged in user, so don't save one that
+		// can't be
+		s, err := newSession(c)
+		if err != nil {
+			return err
+		}
+		if !s.LoggedIn() {
+			return errNotLoggedIn
+		}
+	} else {
+		_, postErr = publish(c, fm, p, expires)
+		if postErr == nil || !api.IsNetworkError(postErr) {
+			return postErr
+		}
+	}
+
+	e, err := queuePost(c, fm, p, expires)
+	if err != nil {
+		if postErr != nil {
+			return fmt.Errorf("%v\nCouldn't save post to outbox: %v", postErr, err)
+		}
+		return fmt.Errorf("Couldn't save post to outbox: %v", err)
+	}
+	if postErr != nil {
+		return &queuedError{entry: e, err: postErr}
+	}
+	log.Errorln("Saved post to outbox as %s. Publish it with: %s outbox flush", e.ID, executable.Name())
+	return nil
+}
+
+// queuePost saves a new post to the outbox, to be published with the given
+// options the next time the outbox is flushed. Unless expires is zero, the
+// post will be deleted after then.
+func queuePost(c *cli.Context, fm api.FrontMatter, p []byte, expires time.Time) (*api.OutboxEntry, error) {
+	s, err := newSession(c)
+	if err != nil {
+		return nil, err
+	}
+	e := s.NewOutboxEntry(api.OutboxPost)
+	e.Content = string(p)
+	e.Collection = fm.Blog
+	e.Font = fm.Font
+	e.Lang = fm.Lang
+	e.Tags = fm.Tags
+	e.Markdown = c.Bool("md")
+	if !expires.IsZero() {
+		e.Expires = &expires
+	}
+	return e, s.Queue(e)
+}
+
+// queueUpdate saves an update to the outbox, replacing the given post with p
+// and changing whichever options are set in fm. Unless force is true, it won't
+// be sent if the post is changed on the server in the meantime.
+func queueUpdate(c *cli.Context, fm api.FrontMatter, p []byte, friendlyID, token string, force bool, updateErr error) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitErrorf(err, "Couldn't save update to outbox: %v", err)
+	}
+	e := s.NewOutboxEntry(api.OutboxUpdate)
+	e.PostID = friendlyID
+	e.Token = token
+	e.Content = string(p)
+	e.Font = fm.Font
+	e.Lang = fm.Lang
+	e.Tags = fm.Tags
+	if !force {
+		if err := s.SetOutboxBase(e); err != nil {
+			return exitErrorf(err, "Couldn't save update to outbox: %v", err)
+		}
+	}
+	if err := s.Queue(e); err != nil {
+		return exitErrorf(err, "Couldn't save update to outbox: %v", err)
+	}
+	if updateErr != nil {
+		return exitError(&queuedError{entry: e, err: updateErr})
+	}
+	log.Errorln("Saved update to outbox as %s. Send it with: %s outbox flush", e.ID, executable.Name())
+	return nil
+}
+
+func queueDelete(c *cli.Context, friendlyID, token string, deleteErr error) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitErrorf(err, "Couldn't save delete to outbox: %v", err)
+	}
+	e := s.NewOutboxEntry(api.OutboxDelete)
+	e.PostID = friendlyID
+	e.Token = token
+	if err := s.Queue(e); err != nil {
+		return exitErrorf(err, "Couldn't save delete to outbox: %v", err)
+	}
+	if deleteErr != nil {
+		return exitError(&queuedError{entry: e, err: deleteErr})
+	}
+	log.Errorln("Saved delete to outbox as %s. Send it with: %s outbox flush", e.ID, executable.Name())
+	return nil
+}
+
+func CmdOutbox(c *cli.Context) error {
+	switch c.Args().First() {
+	case "list", "":
+		return cmdOutboxList(c)
+	case "flush":
+		return cmdOutboxFlush(c)
+	case "drop":
+		return cmdOutboxDrop(c, c.Args().Tail())
+	}
+	return usageError("outbox list|flush|drop [<id>...]")
+}
+
+func cmdOutboxList(c *cli.Context) error {
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	entries, err := s.Outbox()
+	if err != nil {
+		return exitErrorf(err, "Couldn't read outbox: %v", err)
+	}
+	if len(entries) == 0 {
+		log.Info(c, "Outbox is empty.")
+		return nil
+	}
+
+	details := c.Bool("v") || c.Bool("verbose")
+	tw := tabwriter.NewWriter(os.Stdout, 10, 0, 2, ' ', tabwriter.TabIndent)
+	if details {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", "ID", "Queued", "Attempts", "Status", "Request", "Last error")
+	} else {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", "ID", "Queued", "Attempts", "Status", "Request")
+	}
+	for _, e := range entries {
+		queued := e.Created.Local().Format("2006-01-02 15:04")
+		status := "waiting"
+		if e.Failed {
+			status = "failed"
+		}
+		if details {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t\n", e.ID, queued, e.Attempts, status, e.Summary(), e.LastError)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t\n", e.ID, queued, e.Attempts, status, e.Summary())
+		}
+	}
+	return tw.Flush()
+}
+
+func cmdOutboxFlush(c *cli.Context) error {
+	if config.IsTor(c) {
+		log.Info(c, "Sending outbox via hidden service...")
+	} else {
+		log.Info(c, "Sending outbox...")
+	}
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	results, err := s.FlushOutbox(c.Bool("force"))
+	if err != nil {
+		return exitErrorf(err, "Failed to send outbox: %v", err)
+	}
+
+	var okCount, errCount, skipCount int
+	code := ExitOK
+	for _, r := range results {
+		status := fmt.Sprintf("%s (%s)...", r.Entry.ID, r.Entry.Summary())
+		if r.Skipped {
+			if r.Entry.User != s.User() {
+				log.Info(c, "%sskipped, queued by %s", status, r.Entry.User)
+			} else if r.Entry.Failed {
+				log.Info(c, "%sskipped, failed: %s", status, r.Entry.LastError)
+			} else {
+				log.Info(c, "%sskipped, next try at %s", status, r.Entry.NextTry.Local().Format(time.Kitchen))
+			}
+			skipCount++
+		} else if r.Err != nil {
+			log.Errorln("%serror: %v", status, r.Err)
+			if r.Entry.Failed {
+				log.Errorln("Not retrying %s. Drop it with: %s outbox drop %[1]s", r.Entry.ID, executable.Name())
+			}
+			errCount++
+			code = combineExitCode(code, r.Err)
+		} else {
+			log.Info(c, "%sOK", status)
+			okCount++
+			if r.Entry.Action == api.OutboxPost {
+				outputPostURL(c, s, r.Post, r.Entry.Markdown)
+			}
+		}
+	}
+	log.Info(c, "%d sent, %d failed, %d waiting", okCount, errCount, skipCount)
+	if errCount > 0 {
+		return cli.NewExitError("", code)
+	}
+	return nil
+}
+
+func cmdOutboxDrop(c *cli.Context, ids []string) error {
+	if len(ids) == 0 {
+		return usageError("outbox drop <id>...")
+	}
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	for _, id := range ids {
+		if err := s.DropOutboxEntry(id); err != nil {
+			return exitErrorf(err, "Couldn't drop %s: %v", id, err)
+		}
+		log.Info(c, "Dropped %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	writeas "github.com/writeas/go-writeas/v2"
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// postFrontMatter returns the options for publishing a new post given in the
+// current context.
+func postFrontMatter(c *cli.Context) api.FrontMatter {
+	return api.FrontMatter{
+		Blog: config.Collection(c),
+		Font: config.GetFont(c.Bool("code"), c.String("font")),
+		Lang: config.Language(c, true),
+	}
+}
+
+// updateFrontMatter returns the options for replacing a post given in the
+// current context. Unlike new posts, the font and language are only changed
+// if they're given explicitly, so they're otherwise left empty.
+func updateFrontMatter(c *cli.Context) api.FrontMatter {
+	fm := api.FrontMatter{
+		Lang: config.Language(c, false),
+	}
+	if c.Bool("code") || c.String("font") != "" {
+		fm.Font = config.GetFont(c.Bool("code"), c.String("font"))
+	}
+	return fm
+}
+
+// codePost prepares a post to be highlighted as code in the given language,
+// if there is one: it's wrapped in a Markdown code block marked with the
+// language, and given a font that renders Markdown. Posts that already have a
+// code block are only given the font.
+func codePost(fm api.FrontMatter, post []byte, lang string) (api.FrontMatter, []byte) {
+	if lang == "" {
+		return fm, post
+	}
+	if !config.IsMarkdownFont(fm.Font) {
+		fm.Font = string(config.PostFontNormal)
+	}
+	if bytes.Contains(post, []byte("```")) || bytes.Contains(post, []byte("~~~")) {
+		return fm, post
+	}
+	return fm, codeBlock(post, lang)
+}
+
+// codeBlock returns the given text as a fenced Markdown code block, marked
+// with its language if one is given. The fence is longer than any run of
+// backticks in the text, so it can't be closed early.
+func codeBlock(text []byte, lang string) []byte {
+	longest, run := 0, 0
+	for _, ch := range text {
+		if ch == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	var b bytes.Buffer
+	b.WriteString(fence + lang + "\n")
+	if text = bytes.TrimRight(text, "\r\n"); len(text) > 0 {
+		b.Write(text)
+		b.WriteByte('\n')
+	}
+	b.WriteString(fence + "\n")
+	return b.Bytes()
+}
+
+// pasteFiles combines the given files into a single Markdown post, with each
+// one under a heading of its name, in a code block marked with its language.
+func pasteFiles(files []string) ([]byte, error) {
+	var b bytes.Buffer
+	for i, fname := range files {
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		name := fname
+		if filepath.IsAbs(name) {
+			name = filepath.Base(name)
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "## %s\n\n", filepath.ToSlash(name))
+		b.Write(codeBlock(content, config.CodeLangFromFilename(fname)))
+	}
+	return b.Bytes(), nil
+}
+
+// expireTime returns when the post being published should be deleted, given
+// --expire, or the zero time if it shouldn't be. Besides durations like 90m or
+// 36h, it takes a number of days, like 7d.
+func expireTime(c *cli.Context) (time.Time, error) {
+	s := c.String("expire")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	var d time.Duration
+	var err error
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return time.Time{}, cli.NewExitError(fmt.Sprintf("Invalid --expire %q. Give a duration like 30m, 24h or 7d.", s), ExitUsage)
+	}
+	return time.Now().Add(d), nil
+}
+
+// publish creates a post from the given text with the given options, then
+// copies its URL to the clipboard and outputs it. Unless expires is zero, the
+// post is recorded to be deleted after then by gc.
+func publish(c *cli.Context, fm api.FrontMatter, post []byte, expires time.Time) (*writeas.Post, error) {
+	s, err := newSession(c)
+	if err != nil {
+		return nil, err
+	}
+	if !s.LoggedIn() {
+		return nil, errNotLoggedIn
+	}
+
+	p, err := s.Publish(fm.PostParams(post))
+	if err != nil {
+		return nil, err
+	}
+	outputPostURL(c, s, p, c.Bool("md"))
+	if !expires.IsZero() {
+		if err := s.SetExpiry(p.ID, expires); err != nil {
+			log.Errorln("%s: Couldn't save expiry of %s: %v", executable.Name(), p.ID, err)
+		} else {
+			log.Info(c, "Post expires %s. Delete it then with: %s gc", expires.Local().Format("2006-01-02 15:04"), executable.Name())
+		}
+	}
+	return p, nil
+}
+
+// outputPostURL copies the URL of a newly published post to the clipboard
+// and prints it.
+func outputPostURL(c *cli.Context, s *api.Session, p *writeas.Post, md bool) {
+	url := s.PostURL(p)
+	if md && p.Collection == nil {
+		url += ".md"
+	}
+
+	err := clipboard.WriteAll(url)
+	if err != nil {
+		log.Errorln(executable.Name()+": Didn't copy to clipboard: %s", err)
+	} else {
+		log.Info(c, "Copied to clipboard.")
+	}
+
+	fmt.Printf("%s\n", url)
+}
+
+// checkVersion returns an error if the given post has changed on the server
+// since it was fetched here, unless --force or --offline is given. Network
+// errors are ignored, so the update can still be queued.
+func checkVersion(c *cli.Context, s *api.Session, friendlyID string) error {
+	if c.Bool("force") || c.Bool("offline") {
+		return nil
+	}
+	if config.IsTor(c) {
+		log.Info(c, "Checking for changes via hidden service...")
+	} else {
+		log.Info(c, "Checking for changes...")
+	}
+	err := s.CheckVersion(friendlyID)
+	if err != nil && api.IsNetworkError(err) {
+		return nil
+	}
+	return err
+}
+
+// editPost opens the user's editor on the given file, and waits for it to
+// exit.
+func editPost(c *cli.Context, fname string) error {
+	cmd, err := config.EditPostCmd(c, fname)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Error starting editor: %s", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("Editor finished with error: %s", err)
+	}
+	return nil
+}
+
+func readStdIn() ([]byte, error) {
+	post, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from stdin: %v", err)
+	}
+	return post, nil
+}
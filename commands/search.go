@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// CmdSearch finds posts whose title or body matches the given query, on the
+// server, in the posts directory and in drafts. The query is words, "quoted
+// phrases" and #tags, unless --regex is given.
+func CmdSearch(c *cli.Context) error {
+	query := strings.Join(c.Args(), " ")
+	if query == "" {
+		return usageError("search [--regex] <query>")
+	}
+	q := api.SearchQuery{
+		Blog:    c.String("blog"),
+		Offline: c.Bool("offline"),
+	}
+	var err error
+	if c.Bool("regex") {
+		q.Pattern, err = regexp.Compile(query)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid regular expression: %v", err), ExitUsage)
+		}
+	} else {
+		text := api.ParseQuery(query)
+		if text.Empty() {
+			return usageError("search [--regex] <query>")
+		}
+		q.Text = &text
+		q.Pattern = text.Pattern()
+	}
+	if since := c.String("since"); since != "" {
+		q.Since, err = parseDate(since)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid --since %q. Give a date like 2006-01-02.", since), ExitUsage)
+		}
+	}
+	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	q.PostsDir = cfg.Posts.Directory
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if s.LoggedIn() && !q.Offline {
+		if config.IsTor(c) {
+			log.Info(c, "Searching posts via hidden service...")
+		} else {
+			log.Info(c, "Searching posts...")
+		}
+	}
+	results, err := s.Search(q)
+	if err != nil && api.IsNetworkError(err) {
+		log.Warn("%v\nSearching local posts only.", err)
+		q.Offline = true
+		results, err = s.Search(q)
+	}
+	if err != nil {
+		return exitErrorf(err, "Couldn't search posts: %v", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No posts found.")
+		return nil
+	}
+	for i, r := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		printSearchResult(r, q.Pattern)
+	}
+	return nil
+}
+
+// printSearchResult writes a search result to stdout: its ID and where it's
+// found, its title, then its snippet, indented, with each match highlighted
+// if stdout is a terminal.
+func printSearchResult(r api.SearchResult, pattern *regexp.Regexp) {
+	id := r.ID
+	if id == "" {
+		id = "-"
+	}
+	where := r.URL
+	switch {
+	case r.Source == api.SourceDraft:
+		where = "draft " + r.Path
+	case where == "":
+		where = r.Path
+	}
+	fmt.Printf("%s  %s\n", id, where)
+	fmt.Println(highlight(r.Title, pattern))
+	for _, line := range strings.Split(r.Snippet, "\n") {
+		if line != "" {
+			fmt.Println("    " + highlight(line, pattern))
+		}
+	}
+}
+
+// highlight makes each match of the given pattern in text bold, if stdout is
+// a terminal.
+func highlight(text string, pattern *regexp.Regexp) string {
+	if !useColor() {
+		return text
+	}
+	return pattern.ReplaceAllStringFunc(text, func(m string) string {
+		return colorBold + m + colorReset
+	})
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// errNotLoggedIn is returned when a command needs an authenticated user, but
+// nobody is logged in.
+var errNotLoggedIn = &api.Error{
+	Kind: api.KindNotLoggedIn,
+	Msg:  "Not currently logged in. Authenticate with: " + executable.Name() + " auth <username>",
+}
+
+// newSession returns an API session for the host and user selected by the
+// flags and configuration, authenticated if that user is logged in.
+func newSession(c *cli.Context) (*api.Session, error) {
+	dataDir := config.UserDataDir(c.App.ExtraInfo()["configDir"])
+	cfg, err := config.LoadConfig(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load configuration file: %v", err)
+	}
+	hostDir, err := config.HostDirectory(c)
+	if err != nil {
+		return nil, fmt.Errorf("Error checking for host directory: %v", err)
+	}
+	user, err := config.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := api.Options{
+		User:      user,
+		DataDir:   filepath.Join(dataDir, hostDir),
+		UserAgent: config.UserAgent(c),
+		Timeout:   config.Timeout(c, cfg),
+		Retries:   config.Retries(c, cfg),
+		RetryWait: config.RetryWait(c, cfg),
+		Proxy:     config.Proxy(c, cfg),
+		CACert:    config.CACert(c, cfg),
+		Logf: func(s string, p ...interface{}) {
+			log.Info(c, s, p...)
+		},
+	}
+	opts.ClientCert, opts.ClientKey = config.ClientCert(c, cfg)
+	if log.Enabled(log.LevelDebug) {
+		opts.Trace = traceRequest
+	}
+
+	if host := config.HostURL(c); host != "" {
+		opts.Host = host
+	} else if cfg.Default.Host != "" && cfg.Default.User != "" {
+		if parts := strings.Split(cfg.Default.Host, "://"); len(parts) > 1 {
+			opts.Host = cfg.Default.Host
+		} else {
+			opts.Host = "https://" + cfg.Default.Host
+		}
+	} else if config.IsDev() {
+		opts.Host = config.DevBaseURL
+	} else if c.App.Name == "writeas" {
+		opts.Host = config.WriteasBaseURL
+	} else {
+		return nil, fmt.Errorf("Must supply a host. Example: %s --host example.com %s", executable.Name(), c.Command.Name)
+	}
+	if config.IsTor(c) {
+		opts.Host, err = config.TorURL(c, cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.TorSOCKS = config.TorSOCKS(c, cfg)
+		opts.TorIsolation = config.TorIsolation(cfg)
+		if opts.Proxy != "" {
+			log.Info(c, "Ignoring proxy, since the request is going through Tor.")
+		}
+	}
+
+	u, err := config.LoadUser(c)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load user: %v", err)
+	}
+	if u != nil {
+		opts.Token = u.AccessToken
+	}
+
+	return api.NewSession(opts)
+}
+
+// newUserSession is like newSession, but fails if nobody is logged in.
+func newUserSession(c *cli.Context) (*api.Session, error) {
+	s, err := newSession(c)
+	if err != nil {
+		return nil, err
+	}
+	if !s.LoggedIn() {
+		return nil, errNotLoggedIn
+	}
+	return s, nil
+}
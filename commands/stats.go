@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// CmdStats reports how many times each of the user's posts has been viewed,
+// with totals for each blog, as a table, CSV or JSON. With --trend, it shows
+// the views since the last snapshot saved with --snapshot.
+func CmdStats(c *cli.Context) error {
+	format := c.String("format")
+	if format != "text" && format != "csv" && format != "json" {
+		return cli.NewExitError(fmt.Sprintf("Unknown format %q. Use one of: text, csv, json.", format), ExitUsage)
+	}
+	top := c.Int("top")
+	if top < 0 {
+		return usageError("stats [--top N]")
+	}
+	q := api.StatsQuery{
+		Blog:     c.String("blog"),
+		Trend:    c.Bool("trend"),
+		Snapshot: c.Bool("snapshot"),
+	}
+	if since := c.String("since"); since != "" {
+		var err error
+		q.Since, err = parseDate(since)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid --since %q. Give a date like 2006-01-02.", since), ExitUsage)
+		}
+	}
+
+	s, err := newSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	if config.IsTor(c) {
+		log.Info(c, "Getting posts via hidden service...")
+	} else {
+		log.Info(c, "Getting posts...")
+	}
+	st, err := s.PostStats(q)
+	if err != nil {
+		return exitErrorf(err, "Couldn't get stats: %v", err)
+	}
+	if q.Snapshot {
+		log.Info(c, "Saved a snapshot of %d posts", st.TotalPosts)
+	}
+	if q.Trend && st.Since == nil {
+		fmt.Fprintln(os.Stderr, "No earlier snapshot to compare with. Save one with --snapshot.")
+	}
+	// --top only cuts the list of posts; the blogs and totals still count
+	// every post reported
+	if top > 0 && len(st.Posts) > top {
+		st.Posts = st.Posts[:top]
+	}
+
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(st, "", "  ")
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitError)
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	case "csv":
+		return printStatsCSV(st)
+	}
+	if st.TotalPosts == 0 {
+		fmt.Fprintln(os.Stderr, "No posts found.")
+		return nil
+	}
+	printStats(st)
+	return nil
+}
+
+// printStats writes a table of the posts' views to stdout, then one of each
+// blog's, then the totals. A change column is added when comparing with a
+// snapshot.
+func printStats(st *api.Stats) {
+	trend := st.Since != nil
+	tw := tabwriter.NewWriter(os.Stdout, 6, 0, 2, ' ', 0)
+	if trend {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", "Views", "Change", "ID", "Blog", "Title")
+	} else {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", "Views", "ID", "Blog", "Title")
+	}
+	for _, p := range st.Posts {
+		if trend {
+			fmt.Fprintf(tw, "%d\t%+d\t%s\t%s\t%s\n", p.Views, *p.Change, p.ID, blogName(p.Blog), p.Title)
+		} else {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", p.Views, p.ID, blogName(p.Blog), p.Title)
+		}
+	}
+	tw.Flush()
+
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 6, 0, 2, ' ', 0)
+	if trend {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", "Views", "Change", "Posts", "Blog")
+	} else {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", "Views", "Posts", "Blog")
+	}
+	for _, b := range st.Blogs {
+		if trend {
+			fmt.Fprintf(tw, "%d\t%+d\t%d\t%s\n", b.Views, *b.Change, b.Posts, blogName(b.Blog))
+		} else {
+			fmt.Fprintf(tw, "%d\t%d\t%s\n", b.Views, b.Posts, blogName(b.Blog))
+		}
+	}
+	tw.Flush()
+
+	fmt.Println()
+	fmt.Printf("%d views on %d posts", st.TotalViews, st.TotalPosts)
+	if trend {
+		fmt.Printf(", %+d since %s", *st.Change, st.Since.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Println()
+}
+
+// printStatsCSV writes a row for each post to stdout, then one for each blog
+// and one with the totals, after a header. The type column tells them apart,
+// and columns that don't apply to a row are left empty. A change column is
+// added when comparing with a snapshot.
+func printStatsCSV(st *api.Stats) error {
+	trend := st.Since != nil
+	w := csv.NewWriter(os.Stdout)
+	header := []string{"type", "id", "title", "blog", "created", "posts", "views"}
+	if trend {
+		header = append(header, "change")
+	}
+	w.Write(header)
+	write := func(row []string, change *int64) {
+		if trend {
+			row = append(row, strconv.FormatInt(*change, 10))
+		}
+		w.Write(row)
+	}
+	for _, p := range st.Posts {
+		write([]string{"post", p.ID, p.Title, p.Blog, p.Created.Format(time.RFC3339), "", strconv.FormatInt(p.Views, 10)}, p.Change)
+	}
+	for _, b := range st.Blogs {
+		write([]string{"blog", "", "", b.Blog, "", strconv.Itoa(b.Posts), strconv.FormatInt(b.Views, 10)}, b.Change)
+	}
+	write([]string{"total", "", "", "", "", strconv.Itoa(st.TotalPosts), strconv.FormatInt(st.TotalViews, 10)}, st.Change)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	return nil
+}
+
+// blogName returns the given blog alias, or "-" for posts not on a blog.
+func blogName(alias string) string {
+	if alias == "" {
+		return "-"
+	}
+	return alias
+}
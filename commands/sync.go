@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/writeas/writeas-cli/api"
+	"github.com/writeas/writeas-cli/config"
+	"github.com/writeas/writeas-cli/executable"
+	"github.com/writeas/writeas-cli/fileutils"
+	"github.com/writeas/writeas-cli/log"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const userFilename = "writeas_user"
+
+func CmdPull(c *cli.Context) error {
+	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
+	if err != nil {
+		return exitErrorf(err, "Unable to load config: %v", err)
+	}
+	s, err := newUserSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+	// Create posts directory if needed
+	if cfg.Posts.Directory == "" {
+		if err := syncSetUp(c, cfg); err != nil {
+			return exitErrorf(err, "Couldn't set up posts directory: %v", err)
+		}
+	}
+
+	results, err := s.Pull(cfg.Posts.Directory)
+	if err != nil {
+		return exitErrorf(err, "Couldn't pull posts: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			log.Errorln("%s. Skipping post %s.", r.Err, r.ID)
+			continue
+		}
+		log.Info(c, "Saved post "+r.Filename)
+	}
+
+	return nil
+}
+
+func CmdPush(c *cli.Context) error {
+	cfg, err := config.LoadConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]))
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitError)
+	}
+	if cfg.Posts.Directory == "" {
+		return cli.NewExitError(fmt.Sprintf("No posts directory yet. Get your posts first with: %s pull", executable.Name()), ExitUsage)
+	}
+	s, err := newUserSession(c)
+	if err != nil {
+		return exitError(err)
+	}
+
+	results, err := s.Push(cfg.Posts.Directory, c.Bool("force"))
+	if err != nil {
+		return exitError(err)
+	}
+	code := ExitOK
+	for _, r := range results {
+		if r.Err != nil {
+			if api.KindOf(r.Err) == api.KindConflict {
+				log.Errorln("%s Skipping %s; use --force to overwrite it.", r.Err, r.Filename)
+			} else {
+				log.Errorln("%s. Skipping %s.", r.Err, r.Filename)
+			}
+			code = combineExitCode(code, r.Err)
+			continue
+		}
+		log.Info(c, "Updated post %s from %s", r.ID, r.Filename)
+	}
+	if len(results) == 0 {
+		log.Info(c, "Nothing to push.")
+	}
+	if code != ExitOK {
+		return cli.NewExitError("", code)
+	}
+	return nil
+}
+
+func syncSetUp(c *cli.Context, cfg *config.Config) error {
+	// Get user information and fail early (before we make the user do
+	// anything), if we're going to
+	u, err := config.LoadUser(c)
+	if err != nil {
+		return err
+	}
+
+	// Prompt for posts directory
+	defaultDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var dir string
+	fmt.Printf("Posts directory? [%s]: ", defaultDir)
+	fmt.Scanln(&dir)
+	if dir == "" {
+		dir = defaultDir
+	}
+
+	// FIXME: This only works on non-Windows OSes (fix: https://www.reddit.com/r/golang/comments/5t3ezd/hidden_files_directories/)
+	userFilepath := filepath.Join(dir, "."+userFilename)
+
+	// Create directory if needed
+	if !fileutils.Exists(dir) {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			log.Debug("Error creating posts directory: %s", err)
+			return err
+		}
+		// Create username file in directory
+		err = ioutil.WriteFile(userFilepath, []byte(u.User.Username), 0644)
+		fmt.Println("Created posts directory.")
+	}
+
+	// Save preference
+	cfg.Posts.Directory = dir
+	err = config.SaveConfig(config.UserDataDir(c.App.ExtraInfo()["configDir"]), cfg)
+	if err != nil {
+		log.Debug("Unable to save config: %s", err)
+		return err
+	}
+	fmt.Println("Saved config.")
+
+	return nil
+}
@@ -1,7 +0,0 @@
-// +build !debug
-
-package config
-
-func Debug() bool {
-	return false
-}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// CodeFlag marks a post as code. Like a boolean flag, it can be given alone,
+// as --code, or with the code's language, as --code=go. The language must be
+// joined to the flag with "=": as with any boolean flag, --code go is the flag
+// alone, followed by the argument "go".
+type CodeFlag struct {
+	Name  string
+	Usage string
+}
+
+func (f CodeFlag) String() string {
+	return fmt.Sprintf("--%s[=<lang>]\t%s", f.Name, f.Usage)
+}
+
+// GetName returns the flag's name.
+func (f CodeFlag) GetName() string {
+	return f.Name
+}
+
+// Apply adds the flag to the given set. Each set gets its own value, so
+// parsing one command's flags doesn't affect another's.
+func (f CodeFlag) Apply(set *flag.FlagSet) {
+	set.Var(&codeValue{}, f.Name, f.Usage)
+}
+
+// codeValue is the value of a CodeFlag. Its string form is whether the flag
+// was given, so it can be read with cli.Context.Bool.
+type codeValue struct {
+	on   bool
+	lang string
+}
+
+// Set sets the value given with the flag. Only "true" and "false", which the
+// flag package passes for the flag on its own or --code=false, are taken as
+// booleans; anything else is a language, even if ParseBool would accept it,
+// like "t" or "f".
+func (v *codeValue) Set(s string) error {
+	switch s {
+	case "true", "false":
+		v.on, v.lang = s == "true", ""
+		return nil
+	}
+	v.on, v.lang = true, strings.ToLower(s)
+	return nil
+}
+
+func (v *codeValue) String() string {
+	return strconv.FormatBool(v.on)
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (v *codeValue) IsBoolFlag() bool {
+	return true
+}
+
+// CodeLang returns the language given with --code=<lang>, if any.
+func CodeLang(c *cli.Context) string {
+	for _, v := range []interface{}{c.Generic("code"), c.GlobalGeneric("code")} {
+		if cv, ok := v.(*codeValue); ok && cv.lang != "" {
+			return cv.lang
+		}
+	}
+	return ""
+}
+
+// codeExts maps file extensions to the names highlight.js, which WriteFreely
+// uses for syntax highlighting, knows their languages by. Prose formats, like
+// Markdown and plain text, are left out.
+var codeExts = map[string]string{
+	".bash":   "bash",
+	".c":      "c",
+	".cc":     "cpp",
+	".clj":    "clojure",
+	".cpp":    "cpp",
+	".cs":     "csharp",
+	".css":    "css",
+	".dart":   "dart",
+	".diff":   "diff",
+	".erl":    "erlang",
+	".ex":     "elixir",
+	".exs":    "elixir",
+	".go":     "go",
+	".groovy": "groovy",
+	".h":      "c",
+	".hpp":    "cpp",
+	".hs":     "haskell",
+	".html":   "xml",
+	".ini":    "ini",
+	".java":   "java",
+	".js":     "javascript",
+	".json":   "json",
+	".jsx":    "javascript",
+	".kt":     "kotlin",
+	".lua":    "lua",
+	".m":      "objectivec",
+	".mk":     "makefile",
+	".patch":  "diff",
+	".php":    "php",
+	".pl":     "perl",
+	".proto":  "protobuf",
+	".ps1":    "powershell",
+	".py":     "python",
+	".r":      "r",
+	".rb":     "ruby",
+	".rs":     "rust",
+	".scala":  "scala",
+	".scss":   "scss",
+	".sh":     "bash",
+	".sql":    "sql",
+	".swift":  "swift",
+	".tex":    "latex",
+	".toml":   "ini",
+	".ts":     "typescript",
+	".tsx":    "typescript",
+	".vim":    "vim",
+	".xml":    "xml",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".zsh":    "bash",
+}
+
+// codeFilenames are files that are known to be code by their name alone.
+var codeFilenames = map[string]string{
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "makefile",
+	"GNUmakefile": "makefile",
+	"Gemfile":     "ruby",
+	"Rakefile":    "ruby",
+}
+
+// CodeLangFromFilename returns the language of the code in the given file,
+// judging by its name, or an empty string if it isn't known to be code.
+func CodeLangFromFilename(fname string) string {
+	base := filepath.Base(fname)
+	if lang, ok := codeFilenames[base]; ok {
+		return lang
+	}
+	return codeExts[strings.ToLower(filepath.Ext(base))]
+}
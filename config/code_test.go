@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestCodeValue(t *testing.T) {
+	tt := []struct {
+		Value string
+		On    bool
+		Lang  string
+	}{
+		{"true", true, ""},
+		{"false", false, ""},
+		{"go", true, "go"},
+		{"Go", true, "go"},
+		{"t", true, "t"},
+		{"f", true, "f"},
+		{"1", true, "1"},
+	}
+	for _, tc := range tt {
+		v := &codeValue{}
+		if err := v.Set(tc.Value); err != nil {
+			t.Fatalf("%s: %v", tc.Value, err)
+		}
+		if v.on != tc.On || v.lang != tc.Lang {
+			t.Errorf("%s: expected %t %q, got %t %q", tc.Value, tc.On, tc.Lang, v.on, v.lang)
+		}
+	}
+}
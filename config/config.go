@@ -1,8 +1,8 @@
 package config
 
 import (
-	"os"
 	"path/filepath"
+	"time"
 
 	ini "gopkg.in/ini.v1"
 )
@@ -10,16 +10,30 @@ import (
 const (
 	// ConfigFile is the full filename for application configuration files
 	ConfigFile = "config.ini"
+
+	// onionsSection maps instance hostnames to their onion service addresses
+	onionsSection = "onions"
 )
 
 type (
-	// APIConfig is not currently used
+	// APIConfig stores settings for requests made to the API. Retries is nil
+	// when it isn't set, since 0 turns retries off.
 	APIConfig struct {
+		Timeout   time.Duration `ini:"timeout,omitempty"`
+		Retries   *int          `ini:"retries,omitempty"`
+		RetryWait time.Duration `ini:"retry_wait,omitempty"`
+
+		Proxy      string `ini:"proxy,omitempty"`
+		CACert     string `ini:"ca_cert,omitempty"`
+		ClientCert string `ini:"client_cert,omitempty"`
+		ClientKey  string `ini:"client_key,omitempty"`
 	}
 
-	// PostsConfig stores the directory for the user post cache
+	// PostsConfig stores the directory for the user post cache, and the
+	// editor to write posts with
 	PostsConfig struct {
 		Directory string `ini:"directory"`
+		Editor    string `ini:"editor,omitempty"`
 	}
 
 	// DefaultConfig stores the default host and user to authenticate with
@@ -28,11 +42,24 @@ type (
 		User string `ini:"user"`
 	}
 
+	// TorConfig stores how to connect to Tor
+	TorConfig struct {
+		// SOCKS is the host:port of the Tor SOCKS proxy
+		SOCKS string `ini:"socks,omitempty"`
+		// ShareCircuits turns off stream isolation, letting requests for
+		// different accounts use the same Tor circuits
+		ShareCircuits bool `ini:"share_circuits,omitempty"`
+	}
+
 	// Config represents the entire base configuration
 	Config struct {
 		API     APIConfig     `ini:"api"`
 		Default DefaultConfig `ini:"default"`
 		Posts   PostsConfig   `ini:"posts"`
+		Tor     TorConfig     `ini:"tor"`
+
+		// Onions maps instance hostnames to onion service URLs
+		Onions map[string]string `ini:"-"`
 	}
 )
 
@@ -49,6 +76,9 @@ func LoadConfig(dataDir string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if sec, err := cfg.GetSection(onionsSection); err == nil {
+		uc.Onions = sec.KeysHash()
+	}
 	return uc, nil
 }
 
@@ -58,17 +88,14 @@ func SaveConfig(dataDir string, uc *Config) error {
 	if err != nil {
 		return err
 	}
-
-	return cfg.SaveTo(filepath.Join(dataDir, ConfigFile))
-}
-
-var editors = []string{"WRITEAS_EDITOR", "EDITOR"}
-
-func GetConfiguredEditor() string {
-	for _, v := range editors {
-		if e := os.Getenv(v); e != "" {
-			return e
+	if len(uc.Onions) > 0 {
+		sec := cfg.Section(onionsSection)
+		for host, onion := range uc.Onions {
+			if _, err = sec.NewKey(host, onion); err != nil {
+				return err
+			}
 		}
 	}
-	return ""
+
+	return cfg.SaveTo(filepath.Join(dataDir, ConfigFile))
 }
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigRetries(t *testing.T) {
+	tt := []struct {
+		Name    string
+		Data    string
+		Retries int
+	}{
+		{"Unset", "[api]\ntimeout = 1m\n", -1},
+		{"Off", "[api]\nretries = 0\n", 0},
+		{"Set", "[api]\nretries = 4\n", 4},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, ConfigFile), []byte(tc.Data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.Retries < 0 {
+				if cfg.API.Retries != nil {
+					t.Errorf("Expected retries to be unset, got %d", *cfg.API.Retries)
+				}
+			} else if cfg.API.Retries == nil || *cfg.API.Retries != tc.Retries {
+				t.Errorf("Expected %d retries, got %v", tc.Retries, cfg.API.Retries)
+			}
+
+			// Saving keeps the setting as it was
+			if err := SaveConfig(dir, cfg); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, ConfigFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved := strings.Contains(string(b), "retries"); saved != (tc.Retries >= 0) {
+				t.Errorf("Unexpected retries setting saved:\n%s", b)
+			}
+		})
+	}
+}
@@ -22,19 +22,14 @@ func createDataDir(dataDirName string) error {
 	return os.Mkdir(dataDirName, 0700)
 }
 
-// DirMustExist checks for a directory, creates it if not found and either
-// panics or logs and error depending on the status of Debug
+// DirMustExist checks for a directory, creating it if not found, and logs an
+// error if it can't be created.
 func DirMustExist(dataDirName string) {
 	// Ensure we have a data directory to use
 	if !dataDirExists(dataDirName) {
 		err := createDataDir(dataDirName)
 		if err != nil {
-			if Debug() {
-				panic(err)
-			} else {
-				log.Errorln("Error creating data directory: %s", err)
-				return
-			}
+			log.Errorln("Error creating data directory: %s", err)
 		}
 	}
 }
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// editors are the environment variables that can name the user's editor,
+// after WRITEAS_EDITOR and the configured editor.
+var editors = []string{"VISUAL", "EDITOR"}
+
+// fallbackEditors are tried, in order, when no editor is set.
+var fallbackEditors = []string{"vim", "nano", "vi", "micro", "emacs"}
+
+// editorWaitFlags lists GUI editors that return as soon as they've opened a
+// file, unless given a flag to wait until it's closed. The first flag is
+// added when none of them are given.
+var editorWaitFlags = map[string][]string{
+	"atom":          {"--wait", "-w"},
+	"code":          {"--wait", "-w"},
+	"code-insiders": {"--wait", "-w"},
+	"codium":        {"--wait", "-w"},
+	"gedit":         {"--wait", "-w"},
+	"gvim":          {"--nofork", "-f"},
+	"kate":          {"--block", "-b"},
+	"mate":          {"--wait", "-w"},
+	"mvim":          {"--nofork", "-f"},
+	"subl":          {"--wait", "-w"},
+	"zed":           {"--wait", "-w"},
+}
+
+// GetConfiguredEditor returns the editor command the user has chosen, if any.
+// Order of precedence is the WRITEAS_EDITOR environment variable, then the
+// editor in the [posts] section of the configuration file, then the VISUAL
+// and EDITOR environment variables.
+func GetConfiguredEditor(c *cli.Context) string {
+	if e := os.Getenv("WRITEAS_EDITOR"); e != "" {
+		return e
+	}
+	if cfg, _ := LoadConfig(UserDataDir(c.App.ExtraInfo()["configDir"])); cfg != nil && cfg.Posts.Editor != "" {
+		return cfg.Posts.Editor
+	}
+	for _, v := range editors {
+		if e := os.Getenv(v); e != "" {
+			return e
+		}
+	}
+	return ""
+}
+
+// EditorExt returns the file extension, including the dot, for editing a
+// post in the given font, so editors can highlight it properly. Fonts that
+// render Markdown, or md, give ".md".
+func EditorExt(font string, md bool) string {
+	if md || IsMarkdownFont(font) {
+		return ".md"
+	}
+	return ".txt"
+}
+
+// editorCommand returns the command for opening fname with the given editor
+// command line, which may include arguments.
+func editorCommand(editor, fname string) (*exec.Cmd, error) {
+	words, err := SplitShellWords(editor)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse editor command %q: %v", editor, err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("Editor command is empty.")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(words[0]), ".exe")
+	args := words[1:]
+	if flags, ok := editorWaitFlags[name]; ok && !hasAny(args, flags) {
+		args = append(args, flags[0])
+	}
+	return exec.Command(words[0], append(args, fname)...), nil
+}
+
+func hasAny(args, flags []string) bool {
+	for _, a := range args {
+		for _, f := range flags {
+			if a == f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SplitShellWords splits a command line into words the way a POSIX shell
+// would, honoring single and double quotes and backslash escapes. On
+// Windows, backslashes are path separators, so they're kept as-is.
+func SplitShellWords(s string) ([]string, error) {
+	escapes := runtime.GOOS != "windows"
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes, a backslash only escapes some characters
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && escapes:
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
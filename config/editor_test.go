@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("backslashes aren't escapes on Windows")
+	}
+	tt := []struct {
+		Name  string
+		Data  string
+		Words []string
+	}{
+		{"Plain command", "vim", []string{"vim"}},
+		{"Arguments", "code --wait  -n", []string{"code", "--wait", "-n"}},
+		{"Double quotes", `"/Applications/Sublime Text.app/subl" -w`, []string{"/Applications/Sublime Text.app/subl", "-w"}},
+		{"Single quotes", `emacs -nw '--eval=(setq x "y")'`, []string{"emacs", "-nw", `--eval=(setq x "y")`}},
+		{"Escaped space", `/opt/my\ editor/bin/ed`, []string{"/opt/my editor/bin/ed"}},
+		{"Backslash in double quotes", `ed "a\"b\c"`, []string{"ed", `a"b\c`}},
+		{"Empty quotes", `ed ''`, []string{"ed", ""}},
+		{"Blank", "  ", []string{}},
+	}
+	for _, test := range tt {
+		t.Run(test.Name, func(t *testing.T) {
+			words, err := SplitShellWords(test.Data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(words, test.Words) {
+				t.Errorf("Got %q, expected %q", words, test.Words)
+			}
+		})
+	}
+
+	for _, bad := range []string{`vim "file`, `vim 'file`, `vim file\`} {
+		if _, err := SplitShellWords(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	tt := []struct {
+		Editor string
+		Args   []string
+	}{
+		{"nano", []string{"nano", "post.md"}},
+		{"code", []string{"code", "--wait", "post.md"}},
+		{"code -w", []string{"code", "-w", "post.md"}},
+		{"/usr/local/bin/subl -n", []string{"/usr/local/bin/subl", "-n", "--wait", "post.md"}},
+		{"gvim", []string{"gvim", "--nofork", "post.md"}},
+	}
+	for _, test := range tt {
+		cmd, err := editorCommand(test.Editor, "post.md")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Editor, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, test.Args) {
+			t.Errorf("%s: got %q, expected %q", test.Editor, cmd.Args, test.Args)
+		}
+	}
+}
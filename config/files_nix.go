@@ -3,15 +3,15 @@
 package config
 
 import (
-	"fmt"
+	"errors"
 	"os/exec"
 
 	homedir "github.com/mitchellh/go-homedir"
-	"github.com/writeas/writeas-cli/executable"
+	cli "gopkg.in/urfave/cli.v1"
 )
 
 const (
-	NoEditorErr = "Couldn't find default editor. Try setting $EDITOR environment variable in ~/.profile"
+	NoEditorErr = "Couldn't find default editor. Try setting $EDITOR environment variable in ~/.profile, or editor in the [posts] section of " + ConfigFile
 )
 
 func parentDataDir() string {
@@ -23,22 +23,16 @@ func parentDataDir() string {
 	return dir
 }
 
-func EditPostCmd(fname string) *exec.Cmd {
-	editor := GetConfiguredEditor()
-	if editor == "" {
-		// Fall back to default editor
-		path, err := exec.LookPath("vim")
-		if err != nil {
-			path, err = exec.LookPath("nano")
-			if err != nil {
-				return nil
-			}
+// EditPostCmd returns the command for editing the given file in the user's
+// editor, falling back to the first common editor that's installed.
+func EditPostCmd(c *cli.Context, fname string) (*exec.Cmd, error) {
+	if editor := GetConfiguredEditor(c); editor != "" {
+		return editorCommand(editor, fname)
+	}
+	for _, e := range fallbackEditors {
+		if path, err := exec.LookPath(e); err == nil {
+			return exec.Command(path, fname), nil
 		}
-		editor = path
 	}
-	return exec.Command(editor, fname)
-}
-
-func MessageRetryCompose(fname string) string {
-	return fmt.Sprintf("To retry this post, run:\n  cat %s | %s", fname, executable.Name())
+	return nil, errors.New(NoEditorErr)
 }
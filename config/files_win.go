@@ -3,11 +3,10 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"os/exec"
 
-	"github.com/writeas/writeas-cli/executable"
+	cli "gopkg.in/urfave/cli.v1"
 )
 
 const (
@@ -18,11 +17,12 @@ func parentDataDir() string {
 	return os.Getenv("APPDATA")
 }
 
-func EditPostCmd(fname string) *exec.Cmd {
+// EditPostCmd returns the command for editing the given file in the user's
+// editor, if they've set one, or else for typing it at the prompt.
+func EditPostCmd(c *cli.Context, fname string) (*exec.Cmd, error) {
+	if editor := GetConfiguredEditor(c); editor != "" {
+		return editorCommand(editor, fname)
+	}
 	// NOTE this won't work if fname contains spaces.
-	return exec.Command("cmd", "/C copy con "+fname)
-}
-
-func MessageRetryCompose(fname string) string {
-	return fmt.Sprintf("To retry this post, run:\n  type %s | %s", fname, executable.Name())
+	return exec.Command("cmd", "/C copy con "+fname), nil
 }
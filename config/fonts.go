@@ -44,3 +44,9 @@ func GetFont(code bool, font string) string {
 	fmt.Printf("Font '%s' invalid. Using default '%s'\n", font, DefaultFont)
 	return string(DefaultFont)
 }
+
+// IsMarkdownFont returns whether posts with the given font, as stored by the
+// API, are rendered as Markdown rather than shown as plain text.
+func IsMarkdownFont(font string) bool {
+	return font == string(PostFontNormal) || font == string(PostFontSans)
+}
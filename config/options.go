@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry/jibber_jabber"
 	"github.com/writeas/writeas-cli/log"
@@ -18,6 +20,11 @@ const (
 	DevBaseURL     = "https://development.write.as"
 	TorBaseURL     = "http://writeas7pm7rcdqg.onion"
 	torPort        = 9150
+
+	// Defaults for API requests
+	defaultTimeout   = 30 * time.Second
+	defaultRetries   = 2
+	defaultRetryWait = time.Second
 )
 
 func UserAgent(c *cli.Context) string {
@@ -37,23 +44,136 @@ func IsTor(c *cli.Context) bool {
 	return c.Bool("tor") || c.Bool("t")
 }
 
-func TorPort(c *cli.Context) int {
+// TorSOCKS returns the host:port address of the Tor SOCKS proxy. Order of
+// precedence is the tor-socks flag, then the tor-port flag for a proxy on this
+// machine, then the address in cfg, if any, then the Tor Browser default.
+func TorSOCKS(c *cli.Context, cfg *Config) string {
+	if addr := c.GlobalString("tor-socks"); addr != "" {
+		return addr
+	}
 	if c.IsSet("tor-port") && c.Int("tor-port") != 0 {
-		return c.Int("tor-port")
+		return fmt.Sprintf("127.0.0.1:%d", c.Int("tor-port"))
+	}
+	if cfg != nil && cfg.Tor.SOCKS != "" {
+		return cfg.Tor.SOCKS
+	}
+	return fmt.Sprintf("127.0.0.1:%d", torPort)
+}
+
+// TorIsolation returns whether requests should be kept on Tor circuits
+// separate from other accounts and other commands, unless cfg turns that off.
+func TorIsolation(cfg *Config) bool {
+	return cfg == nil || !cfg.Tor.ShareCircuits
+}
+
+// Timeout returns how long to wait for each API request. Order of precedence
+// is the timeout flag, then the value in cfg, if any, then the default.
+func Timeout(c *cli.Context, cfg *Config) time.Duration {
+	if t := c.GlobalDuration("timeout"); t > 0 {
+		return t
+	}
+	if cfg != nil && cfg.API.Timeout > 0 {
+		return cfg.API.Timeout
+	}
+	return defaultTimeout
+}
+
+// Retries returns how many times a failed API request may be retried. Order
+// of precedence is the retries flag, then the value in cfg, if any, then the
+// default. Either can be 0 to turn retries off.
+func Retries(c *cli.Context, cfg *Config) int {
+	if c.GlobalIsSet("retries") && c.GlobalInt("retries") >= 0 {
+		return c.GlobalInt("retries")
+	}
+	if cfg != nil && cfg.API.Retries != nil && *cfg.API.Retries >= 0 {
+		return *cfg.API.Retries
 	}
-	return torPort
+	return defaultRetries
 }
 
-func TorURL(c *cli.Context) string {
-	flagHost := c.String("host")
-	if flagHost != "" && strings.HasSuffix(flagHost, "onion") {
-		return flagHost
+// RetryWait returns how long to wait before retrying a failed API request for
+// the first time.
+func RetryWait(c *cli.Context, cfg *Config) time.Duration {
+	if w := c.GlobalDuration("retry-wait"); w > 0 {
+		return w
 	}
-	cfg, _ := LoadConfig(c.App.ExtraInfo()["configDir"])
-	if cfg != nil && cfg.Default.Host != "" && strings.HasSuffix(cfg.Default.Host, "onion") {
-		return cfg.Default.Host
+	if cfg != nil && cfg.API.RetryWait > 0 {
+		return cfg.API.RetryWait
 	}
-	return TorBaseURL
+	return defaultRetryWait
+}
+
+// Proxy returns the URL of the proxy to send API requests through, if one was
+// given with the proxy flag or configured. If neither is set, the standard
+// HTTPS_PROXY and HTTP_PROXY environment variables apply.
+func Proxy(c *cli.Context, cfg *Config) string {
+	return apiSetting(c, cfg, "proxy", func(cfg *APIConfig) string { return cfg.Proxy })
+}
+
+// CACert returns the path to a PEM bundle of extra certificate authorities to
+// trust, if any.
+func CACert(c *cli.Context, cfg *Config) string {
+	return apiSetting(c, cfg, "ca-cert", func(cfg *APIConfig) string { return cfg.CACert })
+}
+
+// ClientCert returns the paths to the PEM client certificate and key to present
+// to the server, if any. The key may be in the same file as the certificate.
+func ClientCert(c *cli.Context, cfg *Config) (cert, key string) {
+	cert = apiSetting(c, cfg, "client-cert", func(cfg *APIConfig) string { return cfg.ClientCert })
+	key = apiSetting(c, cfg, "client-key", func(cfg *APIConfig) string { return cfg.ClientKey })
+	if key == "" {
+		key = cert
+	}
+	return cert, key
+}
+
+// apiSetting returns the value of the given global flag, falling back to the
+// value from the [api] section of cfg, if any.
+func apiSetting(c *cli.Context, cfg *Config, flag string, fromConfig func(*APIConfig) string) string {
+	if v := c.GlobalString(flag); v != "" {
+		return v
+	}
+	if cfg != nil {
+		return fromConfig(&cfg.API)
+	}
+	return ""
+}
+
+// TorURL returns the onion service URL for the host being used. Order of
+// precedence is a host flag that is itself an onion address, then the onion
+// configured in cfg for the host flag or default host, then a default host
+// that is an onion address. Without any of these, Write.as' onion service is
+// used when publishing to Write.as.
+func TorURL(c *cli.Context, cfg *Config) (string, error) {
+	host := c.GlobalString("host")
+	if host == "" && cfg != nil && cfg.Default.User != "" {
+		host = cfg.Default.Host
+	}
+	hostname := host
+	if parts := strings.Split(host, "://"); len(parts) > 1 {
+		hostname = parts[1]
+	}
+
+	if strings.HasSuffix(hostname, ".onion") {
+		return onionURL(host), nil
+	}
+	if cfg != nil {
+		if onion, ok := cfg.Onions[hostname]; ok && onion != "" {
+			return onionURL(onion), nil
+		}
+	}
+	if hostname == "" || hostname == "write.as" {
+		return TorBaseURL, nil
+	}
+	return "", fmt.Errorf("No onion service configured for %s. Add it to the [%s] section of %s, e.g.:\n  %s = http://<address>.onion", hostname, onionsSection, ConfigFile, hostname)
+}
+
+func onionURL(onion string) string {
+	onion = strings.TrimSuffix(onion, "/")
+	if !strings.Contains(onion, "://") {
+		return "http://" + onion
+	}
+	return onion
 }
 
 func Language(c *cli.Context, auto bool) string {
@@ -106,3 +226,21 @@ func HostDirectory(c *cli.Context) (string, error) {
 
 	return "", nil
 }
+
+// HostURL returns the base URL for the host flag, or an empty string if the
+// flag wasn't given.
+func HostURL(c *cli.Context) string {
+	host := c.GlobalString("host")
+	if host == "" {
+		return ""
+	}
+	insecure := c.Bool("insecure")
+	if parts := strings.Split(host, "://"); len(parts) > 1 {
+		host = parts[1]
+	}
+	scheme := "https://"
+	if insecure {
+		scheme = "http://"
+	}
+	return scheme + host
+}
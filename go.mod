@@ -1,19 +1,25 @@
 module github.com/writeas/writeas-cli
 
 require (
+	filippo.io/age v1.2.1
+	github.com/ProtonMail/go-crypto v1.3.0
 	github.com/atotto/clipboard v0.1.4
 	github.com/cloudfoundry/jibber_jabber v0.0.0-20151120183258-bcc4c8345a21
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/howeyc/gopass v0.0.0-20210920133722-c8aef6fb66ef
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/writeas/go-strip-markdown/v2 v2.1.1
 	github.com/writeas/go-writeas/v2 v2.1.1
 	github.com/writeas/web-core v1.7.0
+	golang.org/x/term v0.34.0
 	gopkg.in/ini.v1 v1.67.0
 	gopkg.in/urfave/cli.v1 v1.20.0
 )
 
 require (
 	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/cloudflare/circl v1.6.0 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/microcosm-cc/bluemonday v1.0.27 // indirect
@@ -22,14 +28,12 @@ require (
 	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
-	github.com/writeas/go-strip-markdown/v2 v2.1.1 // indirect
 	github.com/writeas/impart v1.1.1 // indirect
 	github.com/writeas/saturday v1.7.1 // indirect
 	github.com/writeas/slug v1.2.0 // indirect
 	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
-	golang.org/x/term v0.34.0 // indirect
 	h12.io/socks v1.0.3 // indirect
 )
 
@@ -0,0 +1,127 @@
+package wftest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Result is the outcome of running a command.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+// Home points the user's home directory at a new temporary directory for the
+// rest of the test, so commands don't read or change the real configuration.
+// It returns the directory.
+func Home(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("APPDATA", dir)
+	homedir.DisableCache = true
+	homedir.Reset()
+	return dir
+}
+
+// WriteFile writes a file relative to dir, creating parent directories as
+// needed, and returns its full path.
+func WriteFile(t *testing.T, dir, name, content string) string {
+	fname := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+// Editor sets the user's editor for the rest of the test to a shell script
+// with the given body, which receives the file to edit as $1. Tests using it
+// are skipped on Windows.
+func Editor(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("editor scripts need a Unix shell")
+	}
+	fname := WriteFile(t, t.TempDir(), "editor", "#!/bin/sh\n"+script+"\n")
+	if err := os.Chmod(fname, 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WRITEAS_EDITOR", fname)
+}
+
+// Run runs the app with the given arguments, feeding it stdin and capturing
+// everything it writes. An exit requested by the app is recorded in the
+// result's ExitCode instead of ending the test process. Since it swaps out
+// the process's standard streams, commands must not be run in parallel.
+func Run(t *testing.T, app *cli.App, stdin string, args ...string) Result {
+	t.Helper()
+
+	in, err := ioutil.TempFile(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if _, err := in.WriteString(stdin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&stdout, outR)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&stderr, errR)
+		done <- struct{}{}
+	}()
+
+	origIn, origOut, origErr := os.Stdin, os.Stdout, os.Stderr
+	origErrWriter, origExiter := cli.ErrWriter, cli.OsExiter
+	os.Stdin, os.Stdout, os.Stderr = in, outW, errW
+	cli.ErrWriter = errW
+	app.Writer, app.ErrWriter = outW, errW
+
+	var res Result
+	exited := false
+	cli.OsExiter = func(code int) {
+		if !exited {
+			res.ExitCode = code
+			exited = true
+		}
+	}
+
+	res.Err = app.Run(append([]string{app.Name}, args...))
+
+	os.Stdin, os.Stdout, os.Stderr = origIn, origOut, origErr
+	cli.ErrWriter, cli.OsExiter = origErrWriter, origExiter
+	outW.Close()
+	errW.Close()
+	<-done
+	<-done
+
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+	return res
+}
@@ -0,0 +1,585 @@
+// Package wftest provides a fake WriteFreely API server and helpers for
+// running the writeas and wf command-line apps against it in tests.
+package wftest
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	writeas "github.com/writeas/go-writeas/v2"
+)
+
+// Server is an in-memory WriteFreely instance that implements the parts of
+// the API the CLI uses: authentication, posts, collections, and claiming and
+// moving posts. It serves over TLS, like a real instance would.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	users  map[string]*account
+	tokens map[string]string
+	posts  map[string]*post
+	colls  map[string]*collection
+	nextID int
+}
+
+type account struct {
+	pass  string
+	token string
+}
+
+type post struct {
+	writeas.Post
+	owner string
+}
+
+type collection struct {
+	writeas.Collection
+	owner string
+}
+
+// NewServer starts a new fake WriteFreely server. It's closed automatically
+// when the test finishes.
+func NewServer(t *testing.T) *Server {
+	s := &Server{
+		users:  map[string]*account{},
+		tokens: map[string]string{},
+		posts:  map[string]*post{},
+		colls:  map[string]*collection{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/auth/login", s.handleLogIn)
+	mux.HandleFunc("DELETE /api/auth/me", s.handleLogOut)
+	mux.HandleFunc("GET /api/me/posts", s.handleUserPosts)
+	mux.HandleFunc("GET /api/me/collections", s.handleUserCollections)
+	mux.HandleFunc("POST /api/posts", s.handleCreatePost)
+	mux.HandleFunc("POST /api/posts/claim", s.handleClaimPosts)
+	mux.HandleFunc("POST /api/posts/disperse", s.handleDispersePosts)
+	mux.HandleFunc("GET /api/posts/{id}", s.handleGetPost)
+	mux.HandleFunc("PUT /api/posts/{id}", s.handleUpdatePost)
+	mux.HandleFunc("DELETE /api/posts/{id}", s.handleDeletePost)
+	mux.HandleFunc("GET /api/collections/{alias}", s.handleGetCollection)
+	mux.HandleFunc("POST /api/collections/{alias}/posts", s.handleCreatePost)
+	mux.HandleFunc("GET /api/collections/{alias}/posts/{slug}", s.handleGetCollectionPost)
+	mux.HandleFunc("POST /api/collections/{alias}/collect", s.handleCollectPosts)
+
+	s.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewBlogDomain starts a server for the given blog on the given instance, as
+// if on the blog's own domain. Like WriteFreely, it serves the blog's
+// ActivityPub actor on its home page, but not the API. It's closed
+// automatically when the test finishes.
+func NewBlogDomain(t *testing.T, instance *Server, alias string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":              "Person",
+			"id":                instance.URL + "/api/collections/" + alias,
+			"preferredUsername": alias,
+		})
+	})
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Host returns the host:port the server is listening on.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// WriteCACert saves the server's TLS certificate as a PEM file in the given
+// directory, for use with the --ca-cert option, and returns its path.
+func (s *Server) WriteCACert(t *testing.T, dir string) string {
+	fname := filepath.Join(dir, "wftest-ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := ioutil.WriteFile(fname, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+// AddUser creates an account with the given username and password.
+func (s *Server) AddUser(username, pass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = &account{pass: pass}
+}
+
+// AddCollection creates a blog owned by the given user.
+func (s *Server) AddCollection(username, alias, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.colls[alias] = &collection{
+		Collection: writeas.Collection{
+			Alias: alias,
+			Title: title,
+			URL:   s.URL + "/" + alias + "/",
+		},
+		owner: username,
+	}
+}
+
+// AddPost stores a post owned by the given user, or an anonymous post if the
+// username is empty, and returns the stored post. If collAlias is given, the
+// post is published on that blog.
+func (s *Server) AddPost(username, collAlias, title, body string) writeas.Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.newPost(username, collAlias, title, body)
+	return p.Post
+}
+
+// Post returns the post with the given ID, and whether it exists.
+func (s *Server) Post(id string) (writeas.Post, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.posts[id]
+	if !ok {
+		return writeas.Post{}, false
+	}
+	return p.Post, true
+}
+
+// Owner returns the username of the given post's owner, or an empty string if
+// it's anonymous.
+func (s *Server) Owner(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.posts[id]; ok {
+		return p.owner
+	}
+	return ""
+}
+
+// EditPost changes the given post's title and body, as if someone else had
+// edited it, and returns the updated post. Its updated time always moves
+// forward by at least a second, so the change is seen even in quick tests.
+func (s *Server) EditPost(id, title, body string) (writeas.Post, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.posts[id]
+	if !ok {
+		return writeas.Post{}, false
+	}
+	p.Title, p.Content = title, body
+	p.Updated = laterTime(p.Updated)
+	return p.Post, true
+}
+
+// SetViews sets how many times the given post has been viewed.
+func (s *Server) SetViews(id string, views int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.posts[id]; ok {
+		p.Views = views
+	}
+}
+
+// laterTime returns the current time, or a second after t if that isn't
+// later, at the same one second resolution as stored times.
+func laterTime(t time.Time) time.Time {
+	now := time.Now().UTC().Truncate(time.Second)
+	if !now.After(t) {
+		return t.Add(time.Second)
+	}
+	return now
+}
+
+// newPost must be called with the lock held.
+func (s *Server) newPost(username, collAlias, title, body string) *post {
+	s.nextID++
+	now := time.Now().UTC().Truncate(time.Second)
+	p := &post{
+		Post: writeas.Post{
+			ID:      fmt.Sprintf("post%06d", s.nextID),
+			Token:   fmt.Sprintf("token%06d", s.nextID),
+			Font:    "norm",
+			Type:    writeas.TypePost,
+			Created: now,
+			Updated: now,
+			Title:   title,
+			Content: body,
+		},
+		owner: username,
+	}
+	if c, ok := s.colls[collAlias]; ok {
+		coll := c.Collection
+		p.Collection = &coll
+		p.Slug = slugify(title, p.ID)
+	}
+	s.posts[p.ID] = p
+	return p
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(title, id string) string {
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		return id
+	}
+	return slug
+}
+
+// user returns the user authenticated by the request's access token, if any.
+// It must be called with the lock held.
+func (s *Server) user(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+	return s.tokens[token]
+}
+
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code": status,
+		"data": data,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":      status,
+		"error_msg": msg,
+	})
+}
+
+func (s *Server) handleLogIn(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		Alias string `json:"alias"`
+		Pass  string `json:"pass"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[creds.Alias]
+	if !ok {
+		writeError(w, http.StatusNotFound, "User not found.")
+		return
+	}
+	if u.pass != creds.Pass {
+		writeError(w, http.StatusUnauthorized, "Incorrect password.")
+		return
+	}
+	s.nextID++
+	u.token = fmt.Sprintf("access%06d", s.nextID)
+	s.tokens[u.token] = creds.Alias
+	writeData(w, http.StatusOK, writeas.AuthUser{
+		AccessToken: u.token,
+		User:        &writeas.User{Username: creds.Alias},
+	})
+}
+
+func (s *Server) handleLogOut(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+	if _, ok := s.tokens[token]; !ok {
+		writeError(w, http.StatusNotFound, "Token is invalid.")
+		return
+	}
+	delete(s.tokens, token)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUserPosts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "Not authenticated.")
+		return
+	}
+	posts := []writeas.Post{}
+	for _, p := range s.posts {
+		if p.owner == user {
+			posts = append(posts, p.Post)
+		}
+	}
+	// Newest first, like WriteFreely
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID > posts[j].ID })
+	writeData(w, http.StatusOK, posts)
+}
+
+func (s *Server) handleUserCollections(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "Not authenticated.")
+		return
+	}
+	colls := []writeas.Collection{}
+	for _, c := range s.colls {
+		if c.owner == user {
+			colls = append(colls, c.Collection)
+		}
+	}
+	sort.Slice(colls, func(i, j int) bool { return colls[i].Alias < colls[j].Alias })
+	writeData(w, http.StatusOK, colls)
+}
+
+func (s *Server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
+	var pp writeas.PostParams
+	if err := json.NewDecoder(r.Body).Decode(&pp); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if pp.Content == "" {
+		writeError(w, http.StatusBadRequest, "Supply something to publish.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	alias := r.PathValue("alias")
+	if alias != "" {
+		c, ok := s.colls[alias]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Collection doesn't exist.")
+			return
+		}
+		if c.owner != user {
+			writeError(w, http.StatusForbidden, "You don't own this collection.")
+			return
+		}
+	}
+	p := s.newPost(user, alias, pp.Title, pp.Content)
+	if pp.Font != "" {
+		p.Font = pp.Font
+	}
+	p.Language = pp.Language
+	res := p.Post
+	if user != "" {
+		// Only anonymous posts get an edit token
+		res.Token = ""
+	}
+	writeData(w, http.StatusCreated, res)
+}
+
+func (s *Server) handleGetPost(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.posts[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Post not found.")
+		return
+	}
+	res := p.Post
+	res.Token = ""
+	res.OwnerName = p.owner
+	writeData(w, http.StatusOK, res)
+}
+
+func (s *Server) handleGetCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.colls[r.PathValue("alias")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection doesn't exist.")
+		return
+	}
+	writeData(w, http.StatusOK, c.Collection)
+}
+
+func (s *Server) handleGetCollectionPost(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alias, slug := r.PathValue("alias"), r.PathValue("slug")
+	for _, p := range s.posts {
+		if p.Collection != nil && p.Collection.Alias == alias && p.Slug == slug {
+			res := p.Post
+			res.Token = ""
+			writeData(w, http.StatusOK, res)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Post not found.")
+}
+
+// canEdit returns whether the request may change the given post, either with
+// its edit token or as its owner. It must be called with the lock held.
+func (s *Server) canEdit(r *http.Request, p *post, token string) bool {
+	if token != "" {
+		return p.owner == "" && token == p.Token
+	}
+	user := s.user(r)
+	return user != "" && user == p.owner
+}
+
+func (s *Server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var pp writeas.PostParams
+	if err := json.NewDecoder(r.Body).Decode(&pp); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.posts[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Post not found.")
+		return
+	}
+	if !s.canEdit(r, p, pp.Token) {
+		writeError(w, http.StatusForbidden, "Invalid editing credentials.")
+		return
+	}
+	p.Title, p.Content = pp.Title, pp.Content
+	if pp.Font != "" {
+		p.Font = pp.Font
+	}
+	if pp.Language != nil {
+		p.Language = pp.Language
+	}
+	p.Updated = time.Now().UTC().Truncate(time.Second)
+	res := p.Post
+	res.Token = ""
+	writeData(w, http.StatusOK, res)
+}
+
+func (s *Server) handleDeletePost(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	p, ok := s.posts[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Post not found.")
+		return
+	}
+	if !s.canEdit(r, p, r.URL.Query().Get("token")) {
+		writeError(w, http.StatusForbidden, "Invalid editing credentials.")
+		return
+	}
+	delete(s.posts, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleClaimPosts(w http.ResponseWriter, r *http.Request) {
+	var claims []writeas.OwnedPostParams
+	if err := json.NewDecoder(r.Body).Decode(&claims); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "Not authenticated.")
+		return
+	}
+	res := make([]writeas.ClaimPostResult, len(claims))
+	for i, c := range claims {
+		p, ok := s.posts[c.ID]
+		if !ok {
+			res[i] = writeas.ClaimPostResult{ID: c.ID, Code: http.StatusNotFound, ErrorMessage: "Post not found."}
+			continue
+		}
+		if p.owner != "" || p.Token != c.Token {
+			res[i] = writeas.ClaimPostResult{ID: c.ID, Code: http.StatusForbidden, ErrorMessage: "Invalid token."}
+			continue
+		}
+		p.owner = user
+		claimed := p.Post
+		res[i] = writeas.ClaimPostResult{Code: http.StatusOK, Post: &claimed}
+	}
+	writeData(w, http.StatusOK, res)
+}
+
+// movedPost is the result of moving a single post to or from a collection.
+type movedPost struct {
+	Code         int           `json:"code"`
+	ErrorMessage string        `json:"error_msg,omitempty"`
+	Post         *writeas.Post `json:"post,omitempty"`
+}
+
+func (s *Server) handleCollectPosts(w http.ResponseWriter, r *http.Request) {
+	var posts []writeas.OwnedPostParams
+	if err := json.NewDecoder(r.Body).Decode(&posts); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	c, ok := s.colls[r.PathValue("alias")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection doesn't exist.")
+		return
+	}
+	if user == "" || c.owner != user {
+		writeError(w, http.StatusForbidden, "You don't own this collection.")
+		return
+	}
+	res := make([]movedPost, len(posts))
+	for i, pp := range posts {
+		p, ok := s.posts[pp.ID]
+		if !ok || p.owner != user {
+			res[i] = movedPost{Code: http.StatusNotFound, ErrorMessage: "Post not found."}
+			continue
+		}
+		coll := c.Collection
+		p.Collection = &coll
+		p.Slug = slugify(p.Title, p.ID)
+		moved := p.Post
+		moved.Token = ""
+		res[i] = movedPost{Code: http.StatusOK, Post: &moved}
+	}
+	writeData(w, http.StatusOK, res)
+}
+
+func (s *Server) handleDispersePosts(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(r)
+	if user == "" {
+		writeError(w, http.StatusUnauthorized, "Not authenticated.")
+		return
+	}
+	res := make([]movedPost, len(ids))
+	for i, id := range ids {
+		p, ok := s.posts[id]
+		if !ok || p.owner != user {
+			res[i] = movedPost{Code: http.StatusNotFound, ErrorMessage: "Post not found."}
+			continue
+		}
+		p.Collection = nil
+		p.Slug = ""
+		moved := p.Post
+		moved.Token = ""
+		res[i] = movedPost{Code: http.StatusOK, Post: &moved}
+	}
+	writeData(w, http.StatusOK, res)
+}
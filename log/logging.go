@@ -1,33 +1,221 @@
+// Package log writes diagnostic messages to stderr and, optionally, a log
+// file, at one of several levels.
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	cli "gopkg.in/urfave/cli.v1"
 )
 
+// Level is the severity of a message.
+type Level int
+
+// Levels, from most to least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("Unknown log level %q. Use debug, info, warn or error.", s)
+}
+
+// Options configure where messages are written.
+type Options struct {
+	// Level is the least severe level written to stderr. Info messages are
+	// also written when the command's -v flag is given.
+	Level Level
+	// File, if set, is the path of a file that every message at FileLevel or
+	// above is appended to, with a timestamp.
+	File      string
+	FileLevel Level
+	// JSON writes messages as JSON objects, one per line, instead of text. It
+	// applies to the log file if there is one, or else to stderr.
+	JSON bool
+}
+
+var (
+	mu   sync.Mutex
+	opts = Options{Level: LevelWarn}
+	file *os.File
+)
+
+// Init applies the given options, opening the log file if one is given. It
+// replaces any previous configuration, closing the old log file.
+func Init(o Options) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var f *os.File
+	if o.File != "" {
+		var err error
+		f, err = os.OpenFile(o.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("Unable to open log file: %v", err)
+		}
+	}
+	if file != nil {
+		file.Close()
+	}
+	opts, file = o, f
+	return nil
+}
+
+// Close closes the log file, if any, and goes back to writing only warnings
+// and errors to stderr.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var err error
+	if file != nil {
+		err = file.Close()
+	}
+	opts, file = Options{Level: LevelWarn}, nil
+	return err
+}
+
+// Enabled returns whether messages at the given level are written anywhere.
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l >= opts.Level || (file != nil && l >= opts.FileLevel)
+}
+
+// Debug logs detailed diagnostic messages, shown only with the --debug flag
+// or a debug log level.
+func Debug(s string, p ...interface{}) {
+	write(LevelDebug, false, fmt.Sprintf(s, p...), nil)
+}
+
 // Info logs general diagnostic messages, shown only when the -v or --verbose
 // flag is provided.
 func Info(c *cli.Context, s string, p ...interface{}) {
-	if c.Bool("v") || c.Bool("verbose") || c.GlobalBool("v") || c.GlobalBool("verbose") {
-		fmt.Fprintf(os.Stderr, s+"\n", p...)
-	}
+	verbose := c.Bool("v") || c.Bool("verbose") || c.GlobalBool("v") || c.GlobalBool("verbose")
+	write(LevelInfo, verbose, fmt.Sprintf(s, p...), nil)
 }
 
-// InfolnQuit logs the message to stderr and exits normally (without an error).
-func InfolnQuit(s string, p ...interface{}) {
-	fmt.Fprintf(os.Stderr, s+"\n", p...)
-	os.Exit(0)
+// Warn logs a message about something that went wrong, but didn't stop the
+// command.
+func Warn(s string, p ...interface{}) {
+	write(LevelWarn, false, fmt.Sprintf(s, p...), nil)
 }
 
 // Errorln logs the message to stderr
 func Errorln(s string, p ...interface{}) {
-	fmt.Fprintf(os.Stderr, s+"\n", p...)
+	write(LevelError, false, fmt.Sprintf(s, p...), nil)
+}
+
+// Log logs a message at the given level along with key-value pairs of
+// structured data, e.g. Log(LevelDebug, "request", "status", 200).
+func Log(l Level, msg string, kv ...interface{}) {
+	write(l, false, msg, kv)
+}
+
+// write sends a message to stderr and the log file, if its level is enabled
+// for them. force writes it to stderr regardless of level.
+func write(l Level, force bool, msg string, kv []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	if force || l >= opts.Level {
+		if opts.JSON && file == nil {
+			writeJSON(os.Stderr, now, l, msg, kv)
+		} else {
+			writeText(os.Stderr, time.Time{}, l, msg, kv)
+		}
+	}
+	if file != nil && l >= opts.FileLevel {
+		if opts.JSON {
+			writeJSON(file, now, l, msg, kv)
+		} else {
+			writeText(file, now, l, msg, kv)
+		}
+	}
+}
+
+// writeText writes a message as a line of text, followed by any key-value
+// pairs. Messages with a timestamp are prefixed with it and their level;
+// those without, which are meant for the user, are written as-is, except for
+// debug messages.
+func writeText(w io.Writer, t time.Time, l Level, msg string, kv []interface{}) {
+	var sb strings.Builder
+	if !t.IsZero() {
+		fmt.Fprintf(&sb, "%s %-5s ", t.Format(time.RFC3339), strings.ToUpper(l.String()))
+	} else if l == LevelDebug {
+		sb.WriteString("debug: ")
+	}
+	sb.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		fmt.Fprintf(&sb, " %v=%s", kv[i], textValue(value(kv, i+1)))
+	}
+	sb.WriteByte('\n')
+	io.WriteString(w, sb.String())
+}
+
+// writeJSON writes a message as a single-line JSON object.
+func writeJSON(w io.Writer, t time.Time, l Level, msg string, kv []interface{}) {
+	m := map[string]interface{}{
+		"time":  t.Format(time.RFC3339Nano),
+		"level": l.String(),
+		"msg":   msg,
+	}
+	for i := 0; i < len(kv); i += 2 {
+		v := value(kv, i+1)
+		switch x := v.(type) {
+		case error:
+			v = x.Error()
+		case fmt.Stringer:
+			v = x.String()
+		}
+		m[fmt.Sprint(kv[i])] = v
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": l.String(), "msg": msg})
+	}
+	w.Write(append(b, '\n'))
+}
+
+func value(kv []interface{}, i int) interface{} {
+	if i < len(kv) {
+		return kv[i]
+	}
+	return nil
 }
 
-// ErrorlnQuit logs the message to stderr and exits with an error code.
-func ErrorlnQuit(s string, p ...interface{}) {
-	fmt.Fprintf(os.Stderr, s+"\n", p...)
-	os.Exit(1)
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \"=\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
 }